@@ -0,0 +1,488 @@
+package httplog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ArchiveOption defines the option of Archiver.
+type ArchiveOption struct {
+	// BatchSize is the number of rows read by one query, and deleted by one statement, default 1000.
+	BatchSize int
+	// Pause is the delay between the delete statements, default 100ms.
+	Pause time.Duration
+	// Keep keeps the archived rows in the table, without deleting them.
+	Keep bool
+}
+
+// ArchiveOptionFn defines the function prototype to setting ArchiveOption.
+type ArchiveOptionFn func(o *ArchiveOption)
+
+// ArchiveBatchSize set the number of rows read by one query, and deleted by one statement.
+func ArchiveBatchSize(size int) ArchiveOptionFn { return func(o *ArchiveOption) { o.BatchSize = size } }
+
+// ArchivePause set the delay between the delete statements.
+func ArchivePause(pause time.Duration) ArchiveOptionFn {
+	return func(o *ArchiveOption) { o.Pause = pause }
+}
+
+// ArchiveKeep set whether to keep the archived rows in the table.
+func ArchiveKeep(keep bool) ArchiveOptionFn { return func(o *ArchiveOption) { o.Keep = keep } }
+
+// ArchiveFile is an archived file in the manifest.
+type ArchiveFile struct {
+	// Name is the file name in the archive directory, like biz_log-2021-01-02.jsonl.gz.
+	Name string `json:"name"`
+	// Rows is the number of rows in the file.
+	Rows int64 `json:"rows"`
+	// Bytes is the size of the file.
+	Bytes int64 `json:"bytes"`
+	// SHA256 is the hex SHA-256 checksum of the file.
+	SHA256 string `json:"sha256"`
+}
+
+// ArchiveManifest is the manifest of an archiving, saved as JSON beside the archived files.
+type ArchiveManifest struct {
+	Table   string        `json:"table"`
+	Cutoff  time.Time     `json:"cutoff"`
+	Created time.Time     `json:"created"`
+	Files   []ArchiveFile `json:"files"`
+	// Deleted is the number of rows deleted from the table after the files are verified.
+	Deleted int64 `json:"deleted"`
+}
+
+// Archiver moves the rows older than a cutoff out of the log tables of a SQLStore,
+// into the date-named gzip-compressed JSON Lines files, one JSON object of the columns per row,
+// with a checksum manifest. The rows are deleted only after the files are verified.
+type Archiver struct {
+	store  *SQLStore
+	dir    string
+	option *ArchiveOption
+}
+
+// NewArchiver creates a new Archiver writing the files into the directory.
+func NewArchiver(store *SQLStore, dir string, fns ...ArchiveOptionFn) *Archiver {
+	option := &ArchiveOption{BatchSize: 1000, Pause: 100 * time.Millisecond}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	if option.BatchSize <= 0 {
+		option.BatchSize = 1000
+	}
+
+	return &Archiver{store: store, dir: dir, option: option}
+}
+
+// nolint:gochecknoglobals
+var datePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+
+// archiveWriter writes an archived file, computing its checksum.
+type archiveWriter struct {
+	file *os.File
+	gz   *gzip.Writer
+	sum  hash.Hash
+	bw   *bufio.Writer
+	info ArchiveFile
+	size countWriter
+}
+
+type countWriter struct{ n int64 }
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// Archive archives the rows created before the cutoff from the table, and deletes them after verified.
+func (a *Archiver) Archive(ctx context.Context, table string, cutoff time.Time) (*ArchiveManifest, error) {
+	schema, err := a.store.loadTableSchema(table)
+	if err != nil {
+		return nil, err
+	}
+
+	column, idColumn := timeColumn(schema.Cols), idColumn(schema.Cols)
+	if column == "" || idColumn == "" {
+		return nil, fmt.Errorf("no id and created or started columns found in table %s", table)
+	}
+
+	dir := filepath.Join(a.dir, table)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	manifest := &ArchiveManifest{Table: table, Cutoff: cutoff, Created: time.Now()}
+
+	if err := a.export(ctx, dir, table, column, idColumn, manifest); err != nil {
+		return manifest, err
+	}
+
+	if len(manifest.Files) == 0 {
+		return manifest, nil
+	}
+
+	manifestFile := filepath.Join(dir, table+"-"+manifest.Created.Format("20060102T150405")+".manifest.json")
+	if err := writeManifest(manifestFile, manifest); err != nil {
+		return manifest, err
+	}
+
+	if err := VerifyArchive(dir, manifest); err != nil {
+		return manifest, err
+	}
+
+	if a.option.Keep {
+		return manifest, nil
+	}
+
+	err = a.delete(ctx, dir, table, idColumn, manifest)
+
+	if e := writeManifest(manifestFile, manifest); err == nil {
+		err = e
+	}
+
+	return manifest, err
+}
+
+// export streams the rows page by page ordered by the id column into the archived files.
+func (a *Archiver) export(ctx context.Context, dir, table, column, idColumn string, m *ArchiveManifest) error {
+	d := a.store.Dialect
+	run := NewSQLRun(a.store.DB, NewMapPreparer(""))
+	query := `select * from ` + quoteQualified(d, table) + ` where ` + d.Quote(column) + ` < ` + d.Placeholder(0)
+	limit := ` order by ` + d.Quote(idColumn) + ` limit ` + strconv.Itoa(a.option.BatchSize)
+	writers := make(map[string]*archiveWriter)
+
+	var (
+		lastID string
+		err    error
+	)
+
+	for err == nil {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		var result ExecResult
+
+		if lastID == "" {
+			result = run.DoQuery(query+limit, m.Cutoff)
+		} else {
+			result = run.DoQuery(query+` and `+d.Quote(idColumn)+` > `+d.Placeholder(1)+limit, m.Cutoff, lastID)
+		}
+
+		if err = result.Error; err != nil {
+			break
+		}
+
+		rows := result.StringRows()
+		if len(rows) == 0 {
+			break
+		}
+
+		timeIndex, idIndex := indexOf(result.Headers, column), indexOf(result.Headers, idColumn)
+
+		for _, row := range rows {
+			if err = a.write(dir, table, writers, row[timeIndex], result.Headers, row); err != nil {
+				break
+			}
+		}
+
+		lastID = rows[len(rows)-1][idIndex]
+
+		if len(rows) < a.option.BatchSize {
+			break
+		}
+	}
+
+	for _, w := range writers {
+		if e := w.close(); err == nil {
+			err = e
+		}
+
+		m.Files = append(m.Files, w.info)
+	}
+
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Name < m.Files[j].Name })
+
+	return err
+}
+
+func (a *Archiver) write(dir, table string, writers map[string]*archiveWriter, t string, headers, row []string) error {
+	date := datePattern.FindString(t)
+	if date == "" {
+		date = "unknown"
+	}
+
+	w := writers[date]
+	if w == nil {
+		var err error
+		if w, err = createArchiveWriter(dir, table+"-"+date); err != nil {
+			return err
+		}
+
+		writers[date] = w
+	}
+
+	return w.writeRow(headers, row)
+}
+
+// createArchiveWriter creates the file named base.jsonl.gz, or base.N.jsonl.gz when it exists already.
+func createArchiveWriter(dir, base string) (*archiveWriter, error) {
+	name := base + ".jsonl.gz"
+
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if os.IsExist(err) {
+			name = base + "." + strconv.Itoa(i) + ".jsonl.gz"
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		w := &archiveWriter{file: f, sum: sha256.New(), info: ArchiveFile{Name: name}}
+		w.gz = gzip.NewWriter(io.MultiWriter(f, w.sum, &w.size))
+		w.bw = bufio.NewWriter(w.gz)
+
+		return w, nil
+	}
+}
+
+// writeRow writes the row as a JSON object keeping the column order.
+func (w *archiveWriter) writeRow(headers, row []string) error {
+	_ = w.bw.WriteByte('{')
+
+	for i, h := range headers {
+		if i > 0 {
+			_ = w.bw.WriteByte(',')
+		}
+
+		k, _ := JSONMarshal(h)
+		v, _ := JSONMarshal(row[i])
+		_, _ = w.bw.Write(k)
+		_ = w.bw.WriteByte(':')
+		_, _ = w.bw.Write(v)
+	}
+
+	_, err := w.bw.WriteString("}\n")
+	w.info.Rows++
+
+	return err
+}
+
+func (w *archiveWriter) close() error {
+	err := w.bw.Flush()
+
+	if e := w.gz.Close(); err == nil {
+		err = e
+	}
+
+	if e := w.file.Sync(); err == nil {
+		err = e
+	}
+
+	if e := w.file.Close(); err == nil {
+		err = e
+	}
+
+	w.info.Bytes = w.size.n
+	w.info.SHA256 = hex.EncodeToString(w.sum.Sum(nil))
+
+	return err
+}
+
+func writeManifest(name string, m *ArchiveManifest) error {
+	b, err := JSONMarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, name)
+}
+
+// VerifyArchive verifies the checksums and the row counts of the files in the manifest.
+func VerifyArchive(dir string, m *ArchiveManifest) error {
+	for _, file := range m.Files {
+		if err := verifyArchiveFile(filepath.Join(dir, file.Name), file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func verifyArchiveFile(name string, file ArchiveFile) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	sum := sha256.New()
+
+	zr, err := gzip.NewReader(io.TeeReader(f, sum))
+	if err != nil {
+		return err
+	}
+
+	rows := int64(0)
+	scanner := newArchiveScanner(zr)
+
+	for scanner.Scan() {
+		var row map[string]string
+		if err := JSONUnmarshal(scanner.Bytes(), &row); err != nil {
+			return fmt.Errorf("%s line %d: %w", file.Name, rows+1, err)
+		}
+
+		rows++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// read the remaining bytes, like the gzip trailer, into the checksum.
+	if _, err := io.Copy(ioutil.Discard, f); err != nil {
+		return err
+	}
+
+	if s := hex.EncodeToString(sum.Sum(nil)); s != file.SHA256 {
+		return fmt.Errorf("%s checksum mismatched, expected %s, got %s", file.Name, file.SHA256, s)
+	}
+
+	if rows != file.Rows {
+		return fmt.Errorf("%s rows mismatched, expected %d, got %d", file.Name, file.Rows, rows)
+	}
+
+	return nil
+}
+
+func newArchiveScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	return scanner
+}
+
+// eachArchivedIDs reads the values of the id column from the archived file,
+// and calls fn with at most n of them at a time, the slice is reused after fn returns.
+func eachArchivedIDs(name, idColumn string, n int, fn func(ids []string) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, n)
+	scanner := newArchiveScanner(zr)
+
+	for scanner.Scan() {
+		var row map[string]string
+		if err := JSONUnmarshal(scanner.Bytes(), &row); err != nil {
+			return err
+		}
+
+		if ids = append(ids, row[idColumn]); len(ids) >= n {
+			if err := fn(ids); err != nil {
+				return err
+			}
+
+			ids = ids[:0]
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		return fn(ids)
+	}
+
+	return nil
+}
+
+// delete deletes the archived rows in batches, by the ids read from the verified files one by one,
+// so that the memory is bounded by the batch size.
+func (a *Archiver) delete(ctx context.Context, dir, table, idColumn string, m *ArchiveManifest) error {
+	d := a.store.Dialect
+	prefix := `delete from ` + quoteQualified(d, table) + ` where ` + d.Quote(idColumn) + ` in (`
+	first := true
+
+	deleteIDs := func(ids []string) error {
+		if !first {
+			select {
+			case <-time.After(a.option.Pause):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		first = false
+		marks := make([]string, len(ids))
+		args := make([]interface{}, len(ids))
+
+		for i, id := range ids {
+			marks[i] = d.Placeholder(i)
+			args[i] = id
+		}
+
+		result := NewSQLExec(a.store.DB).DoUpdate(prefix+strings.Join(marks, ",")+`)`, args...)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		m.Deleted += result.RowsAffected
+		logrus.Debugf("archive %s, %d rows deleted", table, m.Deleted)
+
+		return nil
+	}
+
+	for _, file := range m.Files {
+		if err := eachArchivedIDs(filepath.Join(dir, file.Name), idColumn, a.option.BatchSize, deleteIDs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// idColumn returns the column tagged id.
+func idColumn(cols []TableCol) string {
+	for _, c := range cols {
+		if c.Tag == "id" {
+			return c.Name
+		}
+	}
+
+	return ""
+}
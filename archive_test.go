@@ -0,0 +1,78 @@
+package httplog_test
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	f := &fakeDB{query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if !strings.HasPrefix(query, "select *") {
+			return fakeColumns(
+				[]driver.Value{"id", "", "bigint", nil},
+				[]driver.Value{"started", "", "datetime", nil},
+				[]driver.Value{"biz", "", "varchar", int64(60)},
+			)(query, args)
+		}
+
+		cols := []string{"id", "started", "biz"}
+		if len(args) == 1 {
+			return cols, [][]driver.Value{
+				{"1", "2021-01-01 10:00:00", "a"},
+				{"2", "2021-01-01 11:00:00", nil},
+			}, nil
+		}
+
+		return cols, [][]driver.Value{{"3", "2021-01-02 10:00:00", `say "hi"`}}, nil
+	}}
+
+	cutoff := time.Date(2021, 2, 1, 0, 0, 0, 0, time.Local)
+	archiver := httplog.NewArchiver(httplog.NewSQLStore(openFakeDB(f)), dir,
+		httplog.ArchiveBatchSize(2), httplog.ArchivePause(time.Millisecond))
+
+	m, err := archiver.Archive(context.Background(), "biz_log", cutoff)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), m.Deleted)
+	assert.Equal(t, 2, len(m.Files))
+	assert.Equal(t, "biz_log-2021-01-01.jsonl.gz", m.Files[0].Name)
+	assert.Equal(t, int64(2), m.Files[0].Rows)
+
+	execs := f.Execs()
+	assert.Equal(t, []fakeExec{
+		{Query: "delete from `biz_log` where `id` in (?,?)", Args: []driver.Value{"1", "2"}},
+		{Query: "delete from `biz_log` where `id` in (?)", Args: []driver.Value{"3"}},
+	}, execs)
+
+	file, err := os.Open(filepath.Join(dir, "biz_log", m.Files[1].Name))
+	assert.Nil(t, err)
+
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	assert.Nil(t, err)
+
+	content, _ := ioutil.ReadAll(zr)
+	assert.Equal(t, `{"id":"3","started":"2021-01-02 10:00:00","biz":"say \"hi\""}`+"\n", string(content))
+
+	manifests, _ := filepath.Glob(filepath.Join(dir, "biz_log", "*.manifest.json"))
+	assert.Equal(t, 1, len(manifests))
+
+	// a corrupted file fails the verification.
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "biz_log", m.Files[0].Name), []byte("x"), 0o644))
+	assert.NotNil(t, httplog.VerifyArchive(filepath.Join(dir, "biz_log"), m))
+}
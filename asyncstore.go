@@ -0,0 +1,227 @@
+package httplog
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OverflowPolicy defines what AsyncStore does when its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the caller until the queue has room.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the log being stored.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued log to make room for the log being stored.
+	OverflowDropOldest
+)
+
+// AsyncOption defines the option of AsyncStore.
+type AsyncOption struct {
+	// QueueSize is the capacity of the queue, default 1000 (also for a non-positive one).
+	QueueSize int
+	// Workers is the number of goroutines storing logs to the wrapped store, default 1.
+	Workers int
+	// Overflow is the policy when the queue is full, default OverflowBlock.
+	Overflow OverflowPolicy
+	// Backoff, if not nil, retries the wrapped store on failures when it implements StoreE.
+	Backoff *Backoff
+	// DeadLetter, if not nil, receives the logs still failing after the retries.
+	DeadLetter Store
+}
+
+// AsyncOptionFn defines the function prototype to setting AsyncOption.
+type AsyncOptionFn func(o *AsyncOption)
+
+// AsyncQueueSize set the capacity of the queue.
+func AsyncQueueSize(size int) AsyncOptionFn { return func(o *AsyncOption) { o.QueueSize = size } }
+
+// AsyncWorkers set the number of goroutines storing logs to the wrapped store.
+func AsyncWorkers(n int) AsyncOptionFn { return func(o *AsyncOption) { o.Workers = n } }
+
+// AsyncOverflow set the policy when the queue is full.
+func AsyncOverflow(policy OverflowPolicy) AsyncOptionFn {
+	return func(o *AsyncOption) { o.Overflow = policy }
+}
+
+// AsyncRetry set the backoff to retry the failed logs, and the dead letter store for the logs still failing.
+func AsyncRetry(backoff Backoff, deadLetter Store) AsyncOptionFn {
+	return func(o *AsyncOption) {
+		o.Backoff = &backoff
+		o.DeadLetter = deadLetter
+	}
+}
+
+// AsyncStats holds the counters of AsyncStore.
+type AsyncStats struct {
+	// Queued is the total number of logs put into the queue.
+	Queued int64
+	// Dropped is the total number of logs dropped by the overflow policy or after closing.
+	Dropped int64
+	// Pending is the number of logs in the queue now.
+	Pending int
+}
+
+// AsyncStore stores the logs to the wrapped store in background goroutines,
+// so that a slow store does not add to the latency of the requests.
+type AsyncStore struct {
+	store  StoreE
+	option *AsyncOption
+	queue  chan *Log
+	wg     sync.WaitGroup
+
+	// closing is closed at the start of Close to release the callers blocked on the full queue.
+	closing     chan struct{}
+	closingOnce sync.Once
+
+	mu     sync.RWMutex
+	closed bool
+
+	queued  int64
+	dropped int64
+}
+
+// NewAsyncStore creates a new AsyncStore wrapping the store.
+func NewAsyncStore(store Store, fns ...AsyncOptionFn) *AsyncStore {
+	option := &AsyncOption{QueueSize: 1000, Workers: 1}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	if option.Workers <= 0 {
+		option.Workers = 1
+	}
+
+	if option.QueueSize <= 0 {
+		option.QueueSize = 1000
+	}
+
+	s := &AsyncStore{
+		store:   AsStoreE(store),
+		option:  option,
+		queue:   make(chan *Log, option.QueueSize),
+		closing: make(chan struct{}),
+	}
+
+	s.wg.Add(option.Workers)
+
+	for i := 0; i < option.Workers; i++ {
+		go s.work()
+	}
+
+	return s
+}
+
+// Store puts the log into the queue.
+func (s *AsyncStore) Store(l *Log) {
+	_ = s.StoreE(l)
+}
+
+// StoreE puts the log into the queue, and returns ErrDropped when the log is dropped.
+func (s *AsyncStore) StoreE(l *Log) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		atomic.AddInt64(&s.dropped, 1)
+		return ErrDropped
+	}
+
+	switch s.option.Overflow {
+	case OverflowDropNewest:
+		select {
+		case s.queue <- l:
+			atomic.AddInt64(&s.queued, 1)
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+			return ErrDropped
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.queue <- l:
+				atomic.AddInt64(&s.queued, 1)
+				return nil
+			default:
+			}
+
+			select {
+			case <-s.queue:
+				atomic.AddInt64(&s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.queue <- l:
+			atomic.AddInt64(&s.queued, 1)
+		case <-s.closing:
+			atomic.AddInt64(&s.dropped, 1)
+			return ErrDropped
+		}
+	}
+
+	return nil
+}
+
+// Stats returns the counters of the store.
+func (s *AsyncStore) Stats() AsyncStats {
+	return AsyncStats{
+		Queued:  atomic.LoadInt64(&s.queued),
+		Dropped: atomic.LoadInt64(&s.dropped),
+		Pending: len(s.queue),
+	}
+}
+
+// Close stops accepting new logs and waits for the queued logs to be stored,
+// or returns the ctx error when ctx is done before that.
+func (s *AsyncStore) Close(ctx context.Context) error {
+	s.closingOnce.Do(func() { close(s.closing) })
+	s.mu.Lock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *AsyncStore) work() {
+	defer s.wg.Done()
+
+	for l := range s.queue {
+		s.storeSafely(l)
+	}
+}
+
+func (s *AsyncStore) storeSafely(l *Log) {
+	defer func() {
+		if err := recover(); err != nil {
+			logrus.Errorf("async store panic: %v", err)
+		}
+	}()
+
+	if err := storeWithRetry(s.store, s.option.Backoff, s.option.DeadLetter, l); err != nil {
+		logrus.Warnf("failed to store log %s, error: %v", l.ID, err)
+	}
+}
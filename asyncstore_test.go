@@ -0,0 +1,112 @@
+package httplog_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+type blockingStore struct {
+	release chan struct{}
+	mu      sync.Mutex
+	ids     []string
+}
+
+func (s *blockingStore) Store(l *httplog.Log) {
+	<-s.release
+	s.mu.Lock()
+	s.ids = append(s.ids, l.ID)
+	s.mu.Unlock()
+}
+
+func TestAsyncStoreOverflow(t *testing.T) {
+	for _, tc := range []struct {
+		Policy  httplog.OverflowPolicy
+		WantIDs []string
+	}{
+		{Policy: httplog.OverflowDropNewest, WantIDs: []string{"0", "1", "2"}},
+		{Policy: httplog.OverflowDropOldest, WantIDs: []string{"0", "3", "4"}},
+	} {
+		bs := &blockingStore{release: make(chan struct{})}
+		s := httplog.NewAsyncStore(bs, httplog.AsyncQueueSize(2), httplog.AsyncOverflow(tc.Policy))
+
+		s.Store(&httplog.Log{ID: "0"})
+		// wait the only worker to take the first log and block.
+		for s.Stats().Pending > 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		for _, id := range []string{"1", "2", "3", "4"} {
+			s.Store(&httplog.Log{ID: id})
+		}
+
+		assert.Equal(t, int64(2), s.Stats().Dropped)
+
+		close(bs.release)
+		assert.Nil(t, s.Close(context.Background()))
+		assert.Equal(t, tc.WantIDs, bs.ids)
+	}
+}
+
+func TestAsyncStoreCloseTimeout(t *testing.T) {
+	bs := &blockingStore{release: make(chan struct{})}
+	s := httplog.NewAsyncStore(bs, httplog.AsyncWorkers(2))
+
+	s.Store(&httplog.Log{ID: "0"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, s.Close(ctx))
+
+	s.Store(&httplog.Log{ID: "1"})
+	assert.Equal(t, httplog.AsyncStats{Queued: 1, Dropped: 1}, s.Stats())
+
+	close(bs.release)
+	assert.Nil(t, s.Close(context.Background()))
+	assert.Equal(t, []string{"0"}, bs.ids)
+}
+
+func TestAsyncStoreCloseBlocked(t *testing.T) {
+	bs := &blockingStore{release: make(chan struct{})}
+	s := httplog.NewAsyncStore(bs, httplog.AsyncQueueSize(1))
+
+	s.Store(&httplog.Log{ID: "0"})
+
+	for s.Stats().Pending > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	s.Store(&httplog.Log{ID: "1"})
+
+	blocked := make(chan error)
+	go func() { blocked <- s.StoreE(&httplog.Log{ID: "2"}) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, s.Close(ctx))
+	assert.Equal(t, httplog.ErrDropped, <-blocked)
+
+	close(bs.release)
+	assert.Nil(t, s.Close(context.Background()))
+	assert.Equal(t, []string{"0", "1"}, bs.ids)
+
+	assert.NotPanics(t, func() { _ = httplog.NewAsyncStore(bs, httplog.AsyncQueueSize(-1)).Close(context.Background()) })
+
+	// a zero queue size falls back to the default one, not to spin dropping the oldest of an empty queue.
+	bs = &blockingStore{release: make(chan struct{})}
+	s = httplog.NewAsyncStore(bs, httplog.AsyncQueueSize(0), httplog.AsyncOverflow(httplog.OverflowDropOldest))
+
+	for _, id := range []string{"0", "1", "2"} {
+		assert.Nil(t, s.StoreE(&httplog.Log{ID: id}))
+	}
+
+	close(bs.release)
+	assert.Nil(t, s.Close(context.Background()))
+	assert.Equal(t, []string{"0", "1", "2"}, bs.ids)
+}
@@ -0,0 +1,131 @@
+package httplog
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// batcher buffers the items and sends them in batches in a background goroutine,
+// when the batch is full or at the flush interval.
+type batcher struct {
+	size        int
+	maxBuffered int
+	send        func(items []interface{})
+
+	mu     sync.Mutex
+	buf    []interface{}
+	closed bool
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newBatcher creates a new batcher and starts its goroutine.
+func newBatcher(size, maxBuffered int, interval time.Duration, send func(items []interface{})) *batcher {
+	if size <= 0 {
+		size = 1
+	}
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	b := &batcher{
+		size:        size,
+		maxBuffered: maxBuffered,
+		send:        send,
+		kick:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	go b.loop(interval)
+
+	return b
+}
+
+// add adds the item to the buffer, ErrDropped is returned when the buffer is full or the batcher is closed.
+func (b *batcher) add(item interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || b.maxBuffered > 0 && len(b.buf) >= b.maxBuffered {
+		return ErrDropped
+	}
+
+	b.buf = append(b.buf, item)
+
+	if len(b.buf) >= b.size {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (b *batcher) loop(interval time.Duration) {
+	defer close(b.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.kick:
+		case <-ticker.C:
+		case <-b.stop:
+			b.flush()
+			return
+		}
+
+		b.flush()
+	}
+}
+
+// flush sends all the buffered items.
+func (b *batcher) flush() {
+	for {
+		b.mu.Lock()
+		n := len(b.buf)
+
+		if n > b.size {
+			n = b.size
+		}
+
+		items := b.buf[:n:n]
+		b.buf = b.buf[n:]
+		b.mu.Unlock()
+
+		if n == 0 {
+			return
+		}
+
+		b.send(items)
+	}
+}
+
+// close stops accepting items, and sends the buffered items until ctx is done.
+func (b *batcher) close(ctx context.Context) error {
+	b.mu.Lock()
+
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.stop)
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
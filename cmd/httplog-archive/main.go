@@ -0,0 +1,78 @@
+// Command httplog-archive archives the old rows of the httplog tables into gzip-compressed JSON Lines files,
+// and deletes them from the tables after the files are verified.
+//
+//	httplog-archive -dsn 'root:root@tcp(127.0.0.1:3306)/httplog?parseTime=true' -table biz_log -days 90 -dir /data/archive
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/bingoohuang/httplog"
+)
+
+func main() {
+	driver := flag.String("driver", "mysql", "database driver name")
+	dsn := flag.String("dsn", "", "data source name, like root:root@tcp(127.0.0.1:3306)/httplog?parseTime=true")
+	tables := flag.String("table", "", "comma separated log tables to archive")
+	days := flag.Int("days", 90, "archive the rows older than the days")
+	dir := flag.String("dir", ".", "directory to write the archived files")
+	batch := flag.Int("batch", 1000, "number of rows read by one query and deleted by one statement")
+	keep := flag.Bool("keep", false, "keep the archived rows in the tables")
+	flag.Parse()
+
+	if *dsn == "" || *tables == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := sql.Open(*driver, *dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	archiver := httplog.NewArchiver(httplog.NewSQLStore(db), *dir,
+		httplog.ArchiveBatchSize(*batch), httplog.ArchiveKeep(*keep))
+	cutoff := time.Now().AddDate(0, 0, -*days)
+	code := 0
+
+	for _, table := range strings.Split(*tables, ",") {
+		m, err := archiver.Archive(ctx, strings.TrimSpace(table), cutoff)
+		if m != nil {
+			for _, f := range m.Files {
+				fmt.Printf("%s\t%d rows\t%d bytes\tsha256:%s\n", f.Name, f.Rows, f.Bytes, f.SHA256)
+			}
+
+			fmt.Printf("%s: %d files, %d rows deleted\n", m.Table, len(m.Files), m.Deleted)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "archive %s failed: %v\n", table, err)
+
+			code = 1
+		}
+	}
+
+	cancel()
+	_ = db.Close()
+
+	os.Exit(code)
+}
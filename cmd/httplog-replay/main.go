@@ -0,0 +1,133 @@
+// Command httplog-replay re-issues the requests captured by httplog against a target,
+// and reports the status and latency differences against the recorded ones.
+//
+//	httplog-replay -target http://127.0.0.1:8080 -file httplog.jsonl -rate 50 -concurrency 4
+//	httplog-replay -target http://127.0.0.1:8080 -dsn 'root:root@tcp(127.0.0.1:3306)/httplog' -table biz_log -since 1h -scale 1
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"github.com/bingoohuang/httplog"
+)
+
+type headerFlags []string
+
+func (h *headerFlags) String() string     { return strings.Join(*h, ", ") }
+func (h *headerFlags) Set(v string) error { *h = append(*h, v); return nil }
+
+func main() {
+	target := flag.String("target", "", "target base URL, like http://127.0.0.1:8080")
+	files := flag.String("file", "", "comma separated JSON Lines files of the logs, .gz supported")
+	driver := flag.String("driver", "mysql", "database driver name")
+	dsn := flag.String("dsn", "", "data source name, like root:root@tcp(127.0.0.1:3306)/httplog?parseTime=true")
+	table := flag.String("table", "", "log table to replay")
+	since := flag.Duration("since", 24*time.Hour, "replay the rows created within the duration")
+	limit := flag.Int("limit", 10000, "max number of rows to replay")
+	rate := flag.Float64("rate", 0, "max requests per second, 0 for unlimited")
+	concurrency := flag.Int("concurrency", 1, "number of concurrent requests")
+	scale := flag.Float64("scale", 0, "replay by the recorded intervals divided by the scale, 0 to disable")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of a request")
+	verbose := flag.Bool("v", false, "print the requests with changed status or failed")
+
+	var headers headerFlags
+
+	flag.Var(&headers, "header", "header overriding the recorded one, like 'Authorization: Bearer xxx', repeatable")
+	flag.Parse()
+
+	if *target == "" || *files == "" && (*dsn == "" || *table == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logs, err := load(*files, *driver, *dsn, *table, *since, *limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fns := []httplog.ReplayOptionFn{
+		httplog.ReplayRate(*rate), httplog.ReplayConcurrency(*concurrency),
+		httplog.ReplayTimeScale(*scale), httplog.ReplayTimeout(*timeout),
+	}
+
+	for _, h := range headers {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) < 2 {
+			kv = append(kv, "")
+		}
+
+		fns = append(fns, httplog.ReplayHeader(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])))
+	}
+
+	if *verbose {
+		fns = append(fns, httplog.ReplayOnResult(func(r httplog.ReplayResult) {
+			switch {
+			case r.Err != "":
+				fmt.Printf("%s %s %s error: %s\n", r.ID, r.Method, r.URL, r.Err)
+			case r.StatusChanged():
+				fmt.Printf("%s %s %s status %d -> %d, latency %s -> %s\n",
+					r.ID, r.Method, r.URL, r.OrigStatus, r.Status, r.OrigDuration, r.Duration)
+			}
+		}))
+	}
+
+	replayer, err := httplog.NewReplayer(*target, fns...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+
+	report := replayer.Replay(ctx, logs)
+	cancel()
+
+	fmt.Print(report)
+
+	if report.Errors > 0 || len(report.StatusDiffs) > 0 {
+		os.Exit(1)
+	}
+}
+
+func load(files, driver, dsn, table string, since time.Duration, limit int) ([]*httplog.Log, error) {
+	if files != "" {
+		var logs []*httplog.Log
+
+		for _, f := range strings.Split(files, ",") {
+			l, err := httplog.LoadJSONLFile(strings.TrimSpace(f))
+			if err != nil {
+				return nil, fmt.Errorf("load %s: %w", f, err)
+			}
+
+			logs = append(logs, l...)
+		}
+
+		return logs, nil
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+
+	return httplog.LoadSQL(context.Background(), httplog.NewSQLStore(db), table, time.Now().Add(-since), limit)
+}
@@ -11,6 +11,8 @@ type ContextKey int
 const (
 	// CtxKey defines the context key for CtxVar.
 	CtxKey ContextKey = iota
+	// TraceCtxKey defines the context key for TraceContext.
+	TraceCtxKey
 )
 
 // CtxVar defines the context structure.
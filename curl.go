@@ -0,0 +1,82 @@
+package httplog
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Curl returns the cURL command to reproduce the request, with the values of SensitiveHeaders redacted.
+// The binary body is omitted, and the truncated one is kept as captured,
+// both flagged by a WARNING comment line before the command.
+func (l *Log) Curl() string {
+	var b strings.Builder
+
+	binary, truncated := bodyState(l.ReqBody, l.ReqSize)
+
+	switch {
+	case binary:
+		b.WriteString("# WARNING: binary body of " + strconv.FormatInt(l.ReqSize, 10) + " bytes omitted\n")
+	case truncated:
+		b.WriteString("# WARNING: body truncated to " + strconv.Itoa(len(l.ReqBody)) + " of " +
+			strconv.FormatInt(l.ReqSize, 10) + " bytes\n")
+	}
+
+	method := l.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	b.WriteString("curl -X " + shellQuote(method) + " " + shellQuote(l.fullURL()))
+
+	names := make([]string, 0, len(l.ReqHeader))
+	for name := range l.ReqHeader {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strings.EqualFold(name, "Content-Length") {
+			continue // computed by curl from the body.
+		}
+
+		for _, v := range l.ReqHeader[name] {
+			b.WriteString(" \\\n  -H " + shellQuote(name+": "+redactHeader(name, v)))
+		}
+	}
+
+	if l.ReqBody != "" && !binary {
+		b.WriteString(" \\\n  --data-raw " + shellQuote(l.ReqBody))
+	}
+
+	return b.String()
+}
+
+// SensitiveHeaders are the headers whose values are redacted as *** in the cURL commands of the req_curl tag
+// and in the HAR entries, matching the full names, or the trailing segments of the names split by -,
+// like Token of X-Auth-Token, case-insensitively. Set it before serving the requests.
+// nolint:gochecknoglobals
+var SensitiveHeaders = []string{
+	"Authorization", "Cookie", "Set-Cookie", "Token", "Secret", "Password", "Api-Key", "Apikey", "Access-Key",
+}
+
+// redactHeader returns *** for the value of the header in SensitiveHeaders.
+func redactHeader(name, value string) string {
+	lower := strings.ToLower(name)
+
+	for _, h := range SensitiveHeaders {
+		h = strings.ToLower(h)
+		if lower == h || strings.HasSuffix(lower, "-"+h) {
+			return "***"
+		}
+	}
+
+	return value
+}
+
+// shellQuote quotes s in single quotes for the POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,62 @@
+package httplog_test
+
+import (
+	"net/http"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurl(t *testing.T) {
+	l := &httplog.Log{
+		Method: "POST", URL: "/hello?name=it's",
+		ReqHeader: http.Header{
+			"Content-Type":      {"application/json"},
+			"Content-Length":    {"16"},
+			"Authorization":     {"Bearer secret"},
+			"X-Api-Key":         {"k"},
+			"X-Forwarded-Proto": {"https"},
+			"Sec-Websocket-Key": {"dGhlIHNhbXBsZQ=="},
+			"X-Monkey":          {"banana"},
+		},
+		ReqBody: `{"a":"b'c $HOME"}`, ReqSize: 17,
+		Request: &http.Request{Host: "example.com"},
+	}
+
+	cmd := l.Curl()
+	assert.NotContains(t, cmd, "WARNING")
+	assert.NotContains(t, cmd, "secret")
+
+	// run the command by a fake curl printing its arguments to verify the quoting.
+	if sh, err := exec.LookPath("sh"); err == nil {
+		out, err := exec.Command(sh, "-c", `curl() { printf '%s\n' "$@"; }; `+cmd).Output()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{
+			"-X", "POST", "https://example.com/hello?name=it's",
+			"-H", "Authorization: ***",
+			"-H", "Content-Type: application/json",
+			"-H", "Sec-Websocket-Key: dGhlIHNhbXBsZQ==",
+			"-H", "X-Api-Key: ***",
+			"-H", "X-Forwarded-Proto: https",
+			"-H", "X-Monkey: banana",
+			"--data-raw", `{"a":"b'c $HOME"}`,
+		}, strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"))
+	}
+
+	assert.Contains(t, cmd, `-H 'X-Monkey: banana'`)
+	assert.Contains(t, cmd, `-H 'X-Api-Key: ***'`)
+
+	l.ReqSize = 100
+	assert.True(t, strings.HasPrefix(l.Curl(), "# WARNING: body truncated to 17 of 100 bytes\ncurl "))
+
+	l.ReqBody, l.ReqSize = "\x89PNG\x00", 5
+	cmd = l.Curl()
+	assert.True(t, strings.HasPrefix(cmd, "# WARNING: binary body of 5 bytes omitted\ncurl "))
+	assert.NotContains(t, cmd, "--data-raw")
+
+	f := httplog.MustCompileFilter(`req_curl != ""`)
+	assert.True(t, f.Match(l))
+}
@@ -0,0 +1,53 @@
+package httplog
+
+import (
+	"os"
+	"sync"
+)
+
+// DeadLetterFile stores the logs as JSON lines into a local file, synced after each log,
+// so that the logs failed to be stored elsewhere survive, e.g. during a database outage.
+type DeadLetterFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewDeadLetterFile opens the file for appending the dead letters.
+func NewDeadLetterFile(path string) (*DeadLetterFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeadLetterFile{file: f}, nil
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *DeadLetterFile) Store(log *Log) {
+	_ = s.StoreE(log)
+}
+
+// StoreE appends the log as a JSON line.
+func (s *DeadLetterFile) StoreE(log *Log) error {
+	b, err := JSONMarshal(log.Record())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+// Close closes the file.
+func (s *DeadLetterFile) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,331 @@
+package httplog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dialect defines the differences of the SQL databases.
+type Dialect interface {
+	// Name returns the name of the dialect, like mysql, postgres and sqlite.
+	Name() string
+	// LoadColumns loads the columns of the table with their comments.
+	LoadColumns(db MiniDB, table string) ([]TableCol, error)
+	// Placeholder returns the placeholder of the i-th (0-based) parameter, like ? or $1.
+	Placeholder(i int) string
+	// MaxPlaceholders returns the max number of the parameters in one statement.
+	MaxPlaceholders() int
+	// Quote quotes the identifier, like a column name.
+	Quote(name string) string
+	// IsUnknownColumn tells whether the err is caused by a column which does not exist.
+	IsUnknownColumn(err error) bool
+	// CreateTableLike creates the table like the template table if it does not exist.
+	CreateTableLike(db MiniDB, table, template string) error
+	// ListTables lists the tables in the current database or schema.
+	ListTables(db MiniDB) ([]string, error)
+	// DeleteBefore returns the SQL deleting at most limit rows whose column is before the only parameter.
+	DeleteBefore(table, column string, limit int) string
+}
+
+// DialectFor returns the dialect for the database driver name, see LookupDriverName.
+// MySQL dialect is returned for the unknown drivers.
+func DialectFor(driverName string) Dialect {
+	switch strings.ToLower(driverName) {
+	case "postgres", "pgx", "pq", "cloudsqlpostgres", "nrpostgres":
+		return PostgresDialect{}
+	case "sqlite3", "sqlite":
+		return SQLiteDialect{}
+	default:
+		return MySQLDialect{}
+	}
+}
+
+// quoteQualified quotes each part of a qualified name like db.table.
+func quoteQualified(d Dialect, name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = d.Quote(p)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// MySQLDialect is the dialect of MySQL.
+type MySQLDialect struct{}
+
+// Name returns the name of the dialect.
+func (MySQLDialect) Name() string { return "mysql" }
+
+// Placeholder returns the placeholder of the i-th (0-based) parameter.
+func (MySQLDialect) Placeholder(int) string { return "?" }
+
+// MaxPlaceholders returns the max number of the parameters in one prepared statement.
+func (MySQLDialect) MaxPlaceholders() int { return 65535 }
+
+// Quote quotes the identifier.
+func (MySQLDialect) Quote(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// IsUnknownColumn tells whether the err is caused by a column which does not exist.
+func (MySQLDialect) IsUnknownColumn(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "Error 1054") || strings.Contains(err.Error(), "Unknown column"))
+}
+
+// CreateTableLike creates the table by create table ... like, which copies the column comments also.
+func (d MySQLDialect) CreateTableLike(db MiniDB, table, template string) error {
+	return NewSQLExec(db).DoUpdate(`create table if not exists ` + quoteQualified(d, table) +
+		` like ` + quoteQualified(d, template)).Error
+}
+
+// ListTables lists the tables in the current database.
+func (MySQLDialect) ListTables(db MiniDB) ([]string, error) {
+	return listTables(db, `select table_name from information_schema.tables where table_schema = database()`)
+}
+
+// DeleteBefore returns the SQL deleting at most limit rows by delete ... limit.
+func (d MySQLDialect) DeleteBefore(table, column string, limit int) string {
+	return `delete from ` + quoteQualified(d, table) + ` where ` + d.Quote(column) + ` < ? limit ` + strconv.Itoa(limit)
+}
+
+// LoadColumns loads the columns of the table with their comments from information_schema.
+func (MySQLDialect) LoadColumns(db MiniDB, table string) ([]TableCol, error) {
+	run := NewSQLRun(db, NewStructPreparer(TableCol{}))
+	result := run.DoQuery(`
+		 select column_name, column_comment, data_type, character_maximum_length max_length
+		 from information_schema.columns
+		 where table_schema = database()
+		 and table_name = ?
+		 order by ordinal_position`, table)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return result.Rows.([]TableCol), nil
+}
+
+// PostgresDialect is the dialect of PostgreSQL.
+type PostgresDialect struct{}
+
+// Name returns the name of the dialect.
+func (PostgresDialect) Name() string { return "postgres" }
+
+// Placeholder returns the placeholder of the i-th (0-based) parameter.
+func (PostgresDialect) Placeholder(i int) string { return "$" + strconv.Itoa(i+1) }
+
+// MaxPlaceholders returns the max number of the parameters, limited by the 16-bit count of the wire protocol.
+func (PostgresDialect) MaxPlaceholders() int { return 65535 }
+
+// Quote quotes the identifier.
+func (PostgresDialect) Quote(name string) string { return quoteDouble(name) }
+
+// IsUnknownColumn tells whether the err is caused by a column which does not exist.
+func (PostgresDialect) IsUnknownColumn(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := err.Error()
+
+	return strings.Contains(msg, "42703") || strings.Contains(msg, "column") && strings.Contains(msg, "does not exist")
+}
+
+// CreateTableLike creates the table by create table ... (like ... including all), which copies the comments also.
+func (d PostgresDialect) CreateTableLike(db MiniDB, table, template string) error {
+	return NewSQLExec(db).DoUpdate(`create table if not exists ` + quoteQualified(d, table) +
+		` (like ` + quoteQualified(d, template) + ` including all)`).Error
+}
+
+// ListTables lists the tables in the current schema.
+func (PostgresDialect) ListTables(db MiniDB) ([]string, error) {
+	return listTables(db, `select tablename from pg_tables where schemaname = current_schema()`)
+}
+
+// DeleteBefore returns the SQL deleting at most limit rows selected by ctid.
+func (d PostgresDialect) DeleteBefore(table, column string, limit int) string {
+	t := quoteQualified(d, table)
+
+	return `delete from ` + t + ` where ctid in (select ctid from ` + t + ` where ` + d.Quote(column) + ` < $1 limit ` +
+		strconv.Itoa(limit) + `)`
+}
+
+// LoadColumns loads the columns of the table with their comments from pg_description.
+func (PostgresDialect) LoadColumns(db MiniDB, table string) ([]TableCol, error) {
+	run := NewSQLRun(db, NewStructPreparer(TableCol{}))
+	result := run.DoQuery(`
+		 select a.attname column_name, coalesce(d.description, '') column_comment,
+		 t.typname data_type,
+		 case when t.typname in ('varchar', 'bpchar') and a.atttypmod > 4 then a.atttypmod - 4 else 0 end max_length
+		 from pg_attribute a
+		 join pg_type t on t.oid = a.atttypid
+		 left join pg_description d on d.objoid = a.attrelid and d.objsubid = a.attnum
+		 where a.attrelid = to_regclass($1)
+		 and a.attnum > 0 and not a.attisdropped
+		 order by a.attnum`, table)
+
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return result.Rows.([]TableCol), nil
+}
+
+// SQLiteDialect is the dialect of SQLite.
+// SQLite has no column comments, so the tags are parsed from the line comments
+// following the column definitions in the create table statement, like:
+//
+//	create table biz_log(
+//	    id  integer primary key, -- httplog:"id"
+//	    ua  text                 -- httplog:"req_head_User-Agent"
+//	)
+type SQLiteDialect struct{}
+
+// Name returns the name of the dialect.
+func (SQLiteDialect) Name() string { return "sqlite" }
+
+// Placeholder returns the placeholder of the i-th (0-based) parameter.
+func (SQLiteDialect) Placeholder(int) string { return "?" }
+
+// MaxPlaceholders returns the default SQLITE_MAX_VARIABLE_NUMBER before SQLite 3.32.0.
+func (SQLiteDialect) MaxPlaceholders() int { return 999 }
+
+// Quote quotes the identifier.
+func (SQLiteDialect) Quote(name string) string { return quoteDouble(name) }
+
+// IsUnknownColumn tells whether the err is caused by a column which does not exist.
+func (SQLiteDialect) IsUnknownColumn(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "has no column named") ||
+		strings.Contains(err.Error(), "no such column"))
+}
+
+// nolint:gochecknoglobals
+var (
+	typeLengthPattern  = regexp.MustCompile(`\((\d+)\)`)
+	createTablePattern = regexp.MustCompile(`(?is)^\s*create\s+table\s+(if\s+not\s+exists\s+)?("[^"]+"|\S+?)\s*\(`)
+)
+
+// CreateTableLike creates the table by the create table statement of the template with the name replaced,
+// since SQLite has no create table ... like, the indexes are not copied.
+func (d SQLiteDialect) CreateTableLike(db MiniDB, table, template string) error {
+	result := NewSQLRun(db, NewMapPreparer("")).
+		DoQuery(`select sql from sqlite_master where type = 'table' and name = ?`, template)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	rows := result.StringRows()
+	if len(rows) == 0 {
+		return fmt.Errorf("template table %s not found", template)
+	}
+
+	ddl := createTablePattern.ReplaceAllLiteralString(rows[0][0], "create table if not exists "+d.Quote(table)+"(")
+
+	return NewSQLExec(db).DoUpdate(ddl).Error
+}
+
+// ListTables lists the tables in the database.
+func (SQLiteDialect) ListTables(db MiniDB) ([]string, error) {
+	return listTables(db, `select name from sqlite_master where type = 'table'`)
+}
+
+// DeleteBefore returns the SQL deleting at most limit rows selected by rowid.
+func (d SQLiteDialect) DeleteBefore(table, column string, limit int) string {
+	t := d.Quote(table)
+
+	return `delete from ` + t + ` where rowid in (select rowid from ` + t + ` where ` + d.Quote(column) + ` < ? limit ` +
+		strconv.Itoa(limit) + `)`
+}
+
+// LoadColumns loads the columns of the table by pragma table_info,
+// with their comments parsed from the create table statement.
+func (d SQLiteDialect) LoadColumns(db MiniDB, table string) ([]TableCol, error) {
+	run := NewSQLRun(db, NewMapPreparer(""))
+
+	result := run.DoQuery(`select sql from sqlite_master where type = 'table' and name = ?`, table)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	comments := map[string]string{}
+	if rows := result.StringRows(); len(rows) > 0 {
+		comments = parseSQLiteComments(rows[0][0])
+	}
+
+	result = run.DoQuery(`pragma table_info(` + d.Quote(table) + `)`)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	nameIndex, typeIndex := indexOf(result.Headers, "name"), indexOf(result.Headers, "type")
+	if nameIndex < 0 || typeIndex < 0 {
+		return nil, nil
+	}
+
+	cols := make([]TableCol, 0, result.RowsCount)
+
+	for _, row := range result.StringRows() {
+		c := TableCol{Name: row[nameIndex], DataType: strings.ToLower(row[typeIndex])}
+		c.Comment = comments[strings.ToLower(c.Name)]
+
+		if sub := typeLengthPattern.FindStringSubmatch(c.DataType); len(sub) > 0 {
+			c.MaxLength, _ = strconv.Atoi(sub[1])
+		}
+
+		cols = append(cols, c)
+	}
+
+	return cols, nil
+}
+
+// parseSQLiteComments parses the line comments of the columns in the create table statement.
+func parseSQLiteComments(ddl string) map[string]string {
+	comments := make(map[string]string)
+
+	for _, line := range strings.Split(ddl, "\n") {
+		pos := strings.Index(line, "--")
+		if pos < 0 {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimLeft(line[:pos], " \t(,"))
+		if len(fields) == 0 {
+			continue
+		}
+
+		name := strings.ToLower(strings.Trim(fields[0], "\"`[]"))
+		comments[name] = strings.TrimSpace(line[pos+2:])
+	}
+
+	return comments
+}
+
+func listTables(db MiniDB, query string) ([]string, error) {
+	result := NewSQLRun(db, NewMapPreparer("")).DoQuery(query)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	tables := make([]string, 0, result.RowsCount)
+	for _, row := range result.StringRows() {
+		tables = append(tables, row[0])
+	}
+
+	return tables, nil
+}
+
+func quoteDouble(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func indexOf(ss []string, s string) int {
+	for i, v := range ss {
+		if strings.EqualFold(v, s) {
+			return i
+		}
+	}
+
+	return -1
+}
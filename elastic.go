@@ -0,0 +1,310 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ElasticOption defines the option of ElasticStore.
+type ElasticOption struct {
+	// Index is the index name, with the time placeholders resolved by the log creation time,
+	// default httplog-${yyyy}.${MM}.${dd}, see PartitionName.
+	Index string
+	// Fields maps the document fields to the log values, default DefaultFieldMapping().
+	Fields FieldMapping
+	// BatchSize is the max number of documents in one bulk request, default 500.
+	BatchSize int
+	// FlushInterval is the max delay of a document waiting in the buffer, default 1s.
+	FlushInterval time.Duration
+	// MaxBuffered is the max number of documents in the buffer, the newer logs are dropped when full, default 10000.
+	MaxBuffered int
+	// Backoff retries the bulk requests failed and the documents rejected by 429 or 5xx, default DefaultBackoff().
+	Backoff Backoff
+	// DeadLetter, if not nil, receives the logs still failing after the retries, or rejected permanently.
+	DeadLetter Store
+	// Header is the additional header of the bulk requests.
+	Header http.Header
+	// Client is the client to send the bulk requests, default with timeout 10s.
+	Client *http.Client
+}
+
+// ElasticOptionFn defines the function prototype to setting ElasticOption.
+type ElasticOptionFn func(o *ElasticOption)
+
+// ElasticIndex set the index name pattern.
+func ElasticIndex(index string) ElasticOptionFn { return func(o *ElasticOption) { o.Index = index } }
+
+// ElasticFields set the mapping of the document fields.
+func ElasticFields(fields FieldMapping) ElasticOptionFn {
+	return func(o *ElasticOption) { o.Fields = fields }
+}
+
+// ElasticBatch set the max number of documents in one bulk request, and the max delay of a document.
+func ElasticBatch(size int, interval time.Duration) ElasticOptionFn {
+	return func(o *ElasticOption) {
+		o.BatchSize = size
+		o.FlushInterval = interval
+	}
+}
+
+// ElasticMaxBuffered set the max number of documents in the buffer.
+func ElasticMaxBuffered(n int) ElasticOptionFn { return func(o *ElasticOption) { o.MaxBuffered = n } }
+
+// ElasticRetry set the backoff to retry the failures, and the dead letter store for the logs still failing.
+func ElasticRetry(backoff Backoff, deadLetter Store) ElasticOptionFn {
+	return func(o *ElasticOption) {
+		o.Backoff = backoff
+		o.DeadLetter = deadLetter
+	}
+}
+
+// ElasticBasicAuth set the basic authentication of the bulk requests.
+func ElasticBasicAuth(username, password string) ElasticOptionFn {
+	return func(o *ElasticOption) {
+		r, _ := http.NewRequest(http.MethodPost, "/", nil)
+		r.SetBasicAuth(username, password)
+		o.Header.Set("Authorization", r.Header.Get("Authorization"))
+	}
+}
+
+// ElasticHeader set an additional header of the bulk requests, like Authorization: ApiKey xxx.
+func ElasticHeader(key, value string) ElasticOptionFn {
+	return func(o *ElasticOption) { o.Header.Set(key, value) }
+}
+
+// ElasticClient set the client to send the bulk requests.
+func ElasticClient(client *http.Client) ElasticOptionFn {
+	return func(o *ElasticOption) { o.Client = client }
+}
+
+// ElasticStore stores the logs as documents into Elasticsearch or OpenSearch by the _bulk API.
+// The documents are buffered and sent in background, by batch size or by flush interval.
+type ElasticStore struct {
+	url     string
+	option  *ElasticOption
+	getters fieldGetters
+	batcher *batcher
+}
+
+type elasticAction struct {
+	Index elasticMeta `json:"index"`
+}
+
+type elasticMeta struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+type elasticDoc struct {
+	log  *Log
+	body []byte
+}
+
+// NewElasticStore creates a new ElasticStore sending to the server at url, like http://127.0.0.1:9200.
+func NewElasticStore(url string, fns ...ElasticOptionFn) *ElasticStore {
+	option := &ElasticOption{
+		Index:         "httplog-${yyyy}.${MM}.${dd}",
+		Fields:        DefaultFieldMapping(),
+		BatchSize:     500,
+		FlushInterval: time.Second,
+		MaxBuffered:   10000,
+		Backoff:       DefaultBackoff(),
+		Header:        make(http.Header),
+		Client:        &http.Client{Timeout: 10 * time.Second},
+	}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	if option.BatchSize <= 0 {
+		option.BatchSize = 500
+	}
+
+	s := &ElasticStore{
+		url:     strings.TrimSuffix(url, "/") + "/_bulk",
+		option:  option,
+		getters: option.Fields.compile(),
+	}
+
+	s.batcher = newBatcher(option.BatchSize, option.MaxBuffered, option.FlushInterval, func(items []interface{}) {
+		docs := make([]*elasticDoc, len(items))
+		for i, item := range items {
+			docs[i] = item.(*elasticDoc)
+		}
+
+		s.send(docs)
+	})
+
+	return s
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *ElasticStore) Store(log *Log) {
+	if err := s.StoreE(log); err != nil {
+		logrus.Warnf("failed to store log %s to %s, error: %v", log.ID, s.url, err)
+	}
+}
+
+// StoreE buffers the log as a document, ErrDropped is returned when the buffer is full or the store is closed.
+func (s *ElasticStore) StoreE(log *Log) error {
+	doc, err := s.document(log)
+	if err != nil {
+		return err
+	}
+
+	return s.batcher.add(doc)
+}
+
+// document creates the action and the source lines of the bulk request for the log.
+func (s *ElasticStore) document(l *Log) (*elasticDoc, error) {
+	created := l.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	action, err := JSONMarshal(elasticAction{Index: elasticMeta{Index: PartitionName(s.option.Index, created), ID: l.ID}})
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := JSONMarshal(s.getters.document(l))
+	if err != nil {
+		return nil, err
+	}
+
+	body := make([]byte, 0, len(action)+len(source)+2)
+	body = append(append(append(append(body, action...), '\n'), source...), '\n')
+
+	return &elasticDoc{log: l, body: body}, nil
+}
+
+// send sends the documents by bulk requests, retrying the failed ones with backoff.
+func (s *ElasticStore) send(docs []*elasticDoc) {
+	delay := s.option.Backoff.Initial
+
+	for i := 0; ; i++ {
+		retry, err := s.bulk(docs)
+		if len(retry) == 0 {
+			return
+		}
+
+		if i >= s.option.Backoff.Retries {
+			for _, doc := range retry {
+				s.deadLetter(doc, err)
+			}
+
+			return
+		}
+
+		logrus.Warnf("bulk %d documents to %s failed, retry %d documents, error: %v", len(docs), s.url, len(retry), err)
+		time.Sleep(delay)
+
+		delay = s.option.Backoff.next(delay)
+		docs = retry
+	}
+}
+
+// elasticBulkResponse is the response of the _bulk API.
+type elasticBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int         `json:"status"`
+		Error  interface{} `json:"error"`
+	} `json:"items"`
+}
+
+// bulk sends the documents by one bulk request, and returns the documents to retry,
+// the documents rejected permanently are sent to the dead letter store.
+func (s *ElasticStore) bulk(docs []*elasticDoc) ([]*elasticDoc, error) {
+	var body bytes.Buffer
+
+	for _, doc := range docs {
+		body.Write(doc.body)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, &body)
+	if err != nil {
+		return docs, err
+	}
+
+	for k, v := range s.option.Header {
+		req.Header[k] = v
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	rsp, err := s.option.Client.Do(req)
+	if err != nil {
+		return docs, err
+	}
+
+	defer rsp.Body.Close()
+
+	content, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return docs, err
+	}
+
+	if rsp.StatusCode == http.StatusTooManyRequests || rsp.StatusCode >= 500 {
+		return docs, fmt.Errorf("bulk status %d: %s", rsp.StatusCode, Abbreviate(string(content), 200))
+	}
+
+	if rsp.StatusCode >= 300 {
+		err = fmt.Errorf("bulk status %d: %s", rsp.StatusCode, Abbreviate(string(content), 200))
+		for _, doc := range docs {
+			s.deadLetter(doc, err)
+		}
+
+		return nil, err
+	}
+
+	var result elasticBulkResponse
+	if err := JSONUnmarshal(content, &result); err != nil {
+		return docs, err
+	}
+
+	if !result.Errors {
+		return nil, nil
+	}
+
+	var retry []*elasticDoc
+
+	for i, item := range result.Items {
+		if i >= len(docs) {
+			break
+		}
+
+		for _, r := range item {
+			switch {
+			case r.Status == http.StatusTooManyRequests || r.Status >= 500:
+				retry = append(retry, docs[i])
+				err = fmt.Errorf("document status %d: %v", r.Status, r.Error)
+			case r.Status >= 300:
+				s.deadLetter(docs[i], fmt.Errorf("document status %d: %v", r.Status, r.Error))
+			}
+		}
+	}
+
+	return retry, err
+}
+
+func (s *ElasticStore) deadLetter(doc *elasticDoc, err error) {
+	logrus.Warnf("failed to store log %s to %s, error: %v", doc.log.ID, s.url, err)
+
+	if s.option.DeadLetter != nil {
+		s.option.DeadLetter.Store(doc.log)
+	}
+}
+
+// Close stops accepting logs, and sends the buffered documents until ctx is done.
+func (s *ElasticStore) Close(ctx context.Context) error {
+	return s.batcher.close(ctx)
+}
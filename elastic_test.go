@@ -0,0 +1,76 @@
+package httplog_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElasticStore(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		bulks [][]string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/_bulk", r.URL.Path)
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "elastic:secret", user+":"+pass)
+
+		var lines []string
+		for scanner := bufio.NewScanner(r.Body); scanner.Scan(); {
+			lines = append(lines, scanner.Text())
+		}
+
+		mu.Lock()
+		bulks = append(bulks, lines)
+		first := len(bulks) == 1
+		mu.Unlock()
+
+		if first {
+			_, _ = w.Write([]byte(`{"errors":true,"items":[{"index":{"status":201}},` +
+				`{"index":{"status":429,"error":{"type":"es_rejected_execution_exception"}}},` +
+				`{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`))
+		} else {
+			_, _ = w.Write([]byte(`{"errors":false,"items":[{"index":{"status":201}}]}`))
+		}
+	}))
+	defer server.Close()
+
+	dead := &switchStore{}
+	store := httplog.NewElasticStore(server.URL,
+		httplog.ElasticFields(httplog.FieldMapping{"biz": "biz", "user": "ctx_user", "status": "rsp_status"}),
+		httplog.ElasticBatch(3, time.Hour), httplog.ElasticBasicAuth("elastic", "secret"),
+		httplog.ElasticRetry(httplog.Backoff{Retries: 2, Initial: time.Millisecond}, dead))
+
+	created := time.Date(2021, 1, 2, 3, 4, 5, 0, time.Local)
+	for _, id := range []string{"1", "2", "3"} {
+		assert.Nil(t, store.StoreE(&httplog.Log{ID: id, Biz: "b" + id, RspStatus: 200, Created: created,
+			Attrs: httplog.Attrs{"user": "alice"}}))
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(bulks) == 2
+	})
+	assert.Nil(t, store.Close(context.Background()))
+
+	assert.Equal(t, 6, len(bulks[0]))
+	assert.Equal(t, `{"index":{"_index":"httplog-2021.01.02","_id":"1"}}`, bulks[0][0])
+	assert.JSONEq(t, `{"biz":"b1","status":200,"user":"alice"}`, bulks[0][1])
+	assert.Equal(t, 2, len(bulks[1]))
+	assert.Equal(t, `{"index":{"_index":"httplog-2021.01.02","_id":"2"}}`, bulks[1][0])
+	assert.JSONEq(t, `{"biz":"b2","status":200,"user":"alice"}`, bulks[1][1])
+	assert.Equal(t, []string{"3"}, dead.IDs())
+}
@@ -0,0 +1,154 @@
+package httplog_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// fakeDB is an in-memory database/sql driver, which returns the configured rows for queries
+// and records the executed statements.
+type fakeDB struct {
+	mu    sync.Mutex
+	execs []fakeExec
+
+	// query returns the columns and rows for a query.
+	query func(query string, args []driver.Value) ([]string, [][]driver.Value, error)
+	// exec returns the error of an update.
+	exec func(query string, args []driver.Value) error
+	// affected returns the number of rows affected by an update, default 1.
+	affected func(query string, args []driver.Value) int64
+}
+
+type fakeExec struct {
+	Query string
+	Args  []driver.Value
+}
+
+// nolint:gochecknoglobals
+var (
+	fakeDBs   = map[string]*fakeDB{}
+	fakeDBsMu sync.Mutex
+	fakeDBSeq int
+)
+
+// nolint:gochecknoinits
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+// openFakeDB opens a new fake database.
+func openFakeDB(f *fakeDB) *sql.DB {
+	fakeDBsMu.Lock()
+	fakeDBSeq++
+	dsn := fmt.Sprintf("fake%d", fakeDBSeq)
+	fakeDBs[dsn] = f
+	fakeDBsMu.Unlock()
+
+	db, _ := sql.Open("fakedb", dsn)
+
+	return db
+}
+
+// Execs returns the executed statements.
+func (f *fakeDB) Execs() []fakeExec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]fakeExec(nil), f.execs...)
+}
+
+// fakeColumns returns the query function for the columns of information_schema.
+func fakeColumns(cols ...[]driver.Value) func(string, []driver.Value) ([]string, [][]driver.Value, error) {
+	return func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if strings.Contains(query, "information_schema.columns") {
+			return []string{"column_name", "column_comment", "data_type", "max_length"}, cols, nil
+		}
+
+		return nil, nil, fmt.Errorf("unexpected query %s", query)
+	}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+
+	return &fakeConn{db: fakeDBs[dsn]}, nil
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, fmt.Errorf("not supported") }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("no fake db")
+	}
+
+	s.db.mu.Lock()
+	s.db.execs = append(s.db.execs, fakeExec{Query: s.query, Args: args})
+	s.db.mu.Unlock()
+
+	if s.db.exec != nil {
+		if err := s.db.exec(s.query, args); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.db.affected != nil {
+		return driver.RowsAffected(s.db.affected(s.query, args)), nil
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.db == nil || s.db.query == nil {
+		return nil, fmt.Errorf("no fake db")
+	}
+
+	cols, rows, err := s.db.query(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeRows{cols: cols, rows: rows}, nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+	pos  int
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[r.pos])
+	r.pos++
+
+	return nil
+}
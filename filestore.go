@@ -0,0 +1,360 @@
+package httplog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FileOption defines the option of FileStore.
+type FileOption struct {
+	// MaxSize is the size to rotate the file, 0 to disable the rotating by size.
+	MaxSize int64
+	// Daily rotates the file when the day changes.
+	Daily bool
+	// Compress gzips the rotated files.
+	Compress bool
+	// MaxBackups is the number of the rotated files to keep, 0 to keep all.
+	MaxBackups int
+	// ReopenOnSIGHUP reopens the file when receiving SIGHUP, for working with logrotate, default true.
+	ReopenOnSIGHUP bool
+}
+
+// FileOptionFn defines the function prototype to setting FileOption.
+type FileOptionFn func(o *FileOption)
+
+// FileMaxSize set the size to rotate the file.
+func FileMaxSize(size int64) FileOptionFn { return func(o *FileOption) { o.MaxSize = size } }
+
+// FileDaily set whether to rotate the file when the day changes.
+func FileDaily(daily bool) FileOptionFn { return func(o *FileOption) { o.Daily = daily } }
+
+// FileCompress set whether to gzip the rotated files.
+func FileCompress(compress bool) FileOptionFn { return func(o *FileOption) { o.Compress = compress } }
+
+// FileMaxBackups set the number of the rotated files to keep.
+func FileMaxBackups(n int) FileOptionFn { return func(o *FileOption) { o.MaxBackups = n } }
+
+// FileReopenOnSIGHUP set whether to reopen the file when receiving SIGHUP.
+func FileReopenOnSIGHUP(reopen bool) FileOptionFn {
+	return func(o *FileOption) { o.ReopenOnSIGHUP = reopen }
+}
+
+// FileStore stores each log as a JSON line (see LogRecord) into a file,
+// rotating the file by size and/or by day.
+type FileStore struct {
+	path   string
+	option *FileOption
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	day    string
+	closed bool
+
+	hup  chan os.Signal
+	stop chan struct{}
+	wg   sync.WaitGroup
+	// bgMu serializes the background compressing and pruning of the rotated files.
+	bgMu sync.Mutex
+}
+
+// NewFileStore creates a new FileStore appending to the file at path.
+func NewFileStore(path string, fns ...FileOptionFn) (*FileStore, error) {
+	option := &FileOption{ReopenOnSIGHUP: true}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	s := &FileStore{path: path, option: option, stop: make(chan struct{})}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	if option.ReopenOnSIGHUP {
+		s.hup = make(chan os.Signal, 1)
+		signal.Notify(s.hup, syscall.SIGHUP)
+		s.wg.Add(1)
+
+		go s.watchHUP()
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) open() error {
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	s.file = f
+	s.size = fi.Size()
+	s.day = fi.ModTime().Format("2006-01-02")
+
+	if s.size == 0 {
+		s.day = time.Now().Format("2006-01-02")
+	}
+
+	return nil
+}
+
+func (s *FileStore) watchHUP() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.hup:
+			if err := s.Reopen(); err != nil {
+				logrus.Warnf("failed to reopen %s, error: %v", s.path, err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Reopen closes and reopens the file, e.g. after it was moved away by logrotate.
+func (s *FileStore) Reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	if s.file != nil {
+		_ = s.file.Close()
+		s.file = nil
+	}
+
+	return s.open()
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *FileStore) Store(log *Log) {
+	if err := s.StoreE(log); err != nil {
+		logrus.Warnf("failed to write log %s to %s, error: %v", log.ID, s.path, err)
+	}
+}
+
+// StoreE writes the log as a JSON line.
+func (s *FileStore) StoreE(log *Log) error {
+	b, err := JSONMarshal(log.Record())
+	if err != nil {
+		return err
+	}
+
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrDropped
+	}
+
+	if s.shouldRotate(int64(len(b))) {
+		if err := s.rotate(); err != nil {
+			if s.file == nil {
+				return err
+			}
+
+			logrus.Warnf("failed to rotate %s, keep writing to it, error: %v", s.path, err)
+		}
+	} else if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(b)
+	s.size += int64(n)
+
+	return err
+}
+
+func (s *FileStore) shouldRotate(n int64) bool {
+	if s.size == 0 {
+		return false
+	}
+
+	if s.option.MaxSize > 0 && s.size+n > s.option.MaxSize {
+		return true
+	}
+
+	return s.option.Daily && time.Now().Format("2006-01-02") != s.day
+}
+
+// rotate renames the current file to a backup, opens a new one,
+// and compresses and prunes the backups in background.
+// When it fails, the file at the path is reopened, or s.file is nil to be opened by the next write.
+func (s *FileStore) rotate() error {
+	_ = s.file.Close()
+	s.file = nil
+
+	backup := backupName(s.path, time.Now())
+	if err := os.Rename(s.path, backup); err != nil {
+		if e := s.open(); e != nil {
+			logrus.Warnf("failed to reopen %s, error: %v", s.path, e)
+		}
+
+		return err
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+
+		s.bgMu.Lock()
+		defer s.bgMu.Unlock()
+
+		if s.option.Compress {
+			if err := gzipFile(backup); err != nil {
+				logrus.Warnf("failed to compress %s, error: %v", backup, err)
+			}
+		}
+
+		s.prune()
+	}()
+
+	return nil
+}
+
+// backupName returns the name for the rotated file, like httplog-20210102T150405.000.jsonl.
+func backupName(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	for i := 0; ; i++ {
+		name := base + "-" + t.Add(time.Duration(i)*time.Millisecond).Format("20060102T150405.000") + ext
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			if _, err := os.Stat(name + ".gz"); os.IsNotExist(err) {
+				return name
+			}
+		}
+	}
+}
+
+// backups returns the rotated files of the path, the oldest first.
+func backups(path string) []string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	files, _ := filepath.Glob(base + "-*" + ext)
+	gzs, _ := filepath.Glob(base + "-*" + ext + ".gz")
+	files = append(files, gzs...)
+
+	sort.Strings(files)
+
+	return files
+}
+
+func (s *FileStore) prune() {
+	if s.option.MaxBackups <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruneBackups(s.path, s.option.MaxBackups)
+}
+
+// pruneBackups removes the oldest rotated files of the path, keeping the newest n ones.
+func pruneBackups(path string, n int) {
+	files := backups(path)
+
+	for i := 0; i < len(files)-n; i++ {
+		if err := os.Remove(files[i]); err != nil {
+			logrus.Warnf("failed to remove %s, error: %v", files[i], err)
+		}
+	}
+}
+
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+
+	if err != nil {
+		_ = os.Remove(name + ".gz")
+		return err
+	}
+
+	return os.Remove(name)
+}
+
+// Close closes the file, and waits for the background compressing.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.closed = true
+
+	var err error
+	if s.file != nil {
+		err = s.file.Close()
+	}
+
+	s.mu.Unlock()
+
+	if s.hup != nil {
+		signal.Stop(s.hup)
+	}
+
+	close(s.stop)
+	s.wg.Wait()
+
+	return err
+}
@@ -0,0 +1,120 @@
+package httplog_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStoreRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "httplog.jsonl")
+	s, err := httplog.NewFileStore(path, httplog.FileMaxSize(400),
+		httplog.FileCompress(true), httplog.FileMaxBackups(2))
+	assert.Nil(t, err)
+
+	for _, id := range []string{"1", "2", "3", "4", "5", "6"} {
+		assert.Nil(t, s.StoreE(&httplog.Log{ID: id, Biz: "biz", RspStatus: 200, Start: time.Now()}))
+	}
+
+	assert.Nil(t, s.Close())
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "httplog-*.jsonl.gz"))
+	assert.Len(t, backups, 2)
+
+	f, err := os.Open(backups[1])
+	assert.Nil(t, err)
+
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	assert.Nil(t, err)
+
+	content, _ := ioutil.ReadAll(zr)
+
+	var r httplog.LogRecord
+
+	assert.Nil(t, httplog.JSONUnmarshal([]byte(strings.Split(string(content), "\n")[0]), &r))
+	assert.Equal(t, "biz", r.Biz)
+	assert.Equal(t, 200, r.RspStatus)
+
+	current, _ := ioutil.ReadFile(path)
+	assert.True(t, len(current) > 0 && len(current) <= 400)
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "httplog.jsonl")
+	s, err := httplog.NewFileStore(path)
+	assert.Nil(t, err)
+
+	s.Store(&httplog.Log{ID: "1"})
+	// logrotate moves the file away and sends SIGHUP.
+	assert.Nil(t, os.Rename(path, path+".1"))
+	assert.Nil(t, s.Reopen())
+	s.Store(&httplog.Log{ID: "2"})
+	assert.Nil(t, s.Close())
+
+	moved, _ := ioutil.ReadFile(path + ".1")
+	current, _ := ioutil.ReadFile(path)
+
+	assert.Contains(t, string(moved), `"id":"1"`)
+	assert.Contains(t, string(current), `"id":"2"`)
+
+	// the file is opened again by the next write after a failed reopening.
+	s, err = httplog.NewFileStore(path)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Remove(path))
+	assert.Nil(t, os.Mkdir(path, 0o755))
+	assert.NotNil(t, s.Reopen())
+	assert.Nil(t, os.Remove(path))
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "3"}))
+	assert.Nil(t, s.Close())
+
+	current, _ = ioutil.ReadFile(path)
+	assert.Contains(t, string(current), `"id":"3"`)
+}
+
+func TestFileStoreRotateFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "httplog.jsonl")
+	s, err := httplog.NewFileStore(path, httplog.FileMaxSize(200))
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "1", Start: time.Now()}))
+
+	// the rename of the rotation fails when the file is removed with its directory.
+	assert.Nil(t, os.RemoveAll(filepath.Join(dir, "logs")))
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "2", Start: time.Now()}))
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "3", Start: time.Now()}))
+	assert.Nil(t, s.Close())
+
+	// 2 is written to the reopened file, which is rotated by 3.
+	backups, _ := filepath.Glob(filepath.Join(dir, "logs", "httplog-*.jsonl"))
+	assert.Len(t, backups, 1)
+
+	for name, id := range map[string]string{backups[0]: "2", path: "3"} {
+		content, err := ioutil.ReadFile(name)
+		assert.Nil(t, err)
+		assert.Contains(t, string(content), `"id":"`+id+`"`)
+	}
+}
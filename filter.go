@@ -0,0 +1,451 @@
+package httplog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Filter is a compiled predicate over the log values, by the tags the same as the ones in the comments
+// of the log table columns, like rsp_status >= 400 && biz != "health", cost > 500, req_head_X-Debug == "1".
+//
+// The operators are ||, &&, !, parentheses, and the comparisons ==, !=, >, >=, <, <=,
+// the operands are the tags, the string literals in double or single quotes, the numbers, and true/false.
+// A single operand is true when it is not empty, zero or false.
+// The comparison is numeric when both sides are numbers, otherwise by their strings.
+type Filter struct {
+	expr string
+	root filterNode
+}
+
+// CompileFilter compiles the expression, the error is returned when it is invalid or has unknown tags.
+func CompileFilter(expr string) (*Filter, error) {
+	p := &filterParser{expr: expr}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != filterEOF {
+		return nil, p.errorf(t, "unexpected %s", t.text)
+	}
+
+	return &Filter{expr: expr, root: root}, nil
+}
+
+// MustCompileFilter is like CompileFilter but panics if the expression is invalid.
+func MustCompileFilter(expr string) *Filter {
+	f, err := CompileFilter(expr)
+	if err != nil {
+		panic(err)
+	}
+
+	return f
+}
+
+// String returns the expression of the filter.
+func (f *Filter) String() string { return f.expr }
+
+// Match tells whether the log matches the filter.
+func (f *Filter) Match(l *Log) bool { return filterTruthy(f.root.eval(l)) }
+
+// FilterStore stores the logs matching the filter to the underlying store,
+// composed by Stores to route the logs to different stores, like the errors to an error_log table.
+type FilterStore struct {
+	Filter *Filter
+	store  StoreE
+}
+
+// NewFilterStore creates a new FilterStore, the error is returned when the expression is invalid.
+func NewFilterStore(expr string, store Store) (*FilterStore, error) {
+	f, err := CompileFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FilterStore{Filter: f, store: AsStoreE(store)}, nil
+}
+
+// MustFilterStore is like NewFilterStore but panics if the expression is invalid.
+func MustFilterStore(expr string, store Store) *FilterStore {
+	s, err := NewFilterStore(expr, store)
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *FilterStore) Store(log *Log) {
+	if err := s.StoreE(log); err != nil {
+		logrus.Warnf("failed to store log %s, error: %v", log.ID, err)
+	}
+}
+
+// StoreE stores the log when it matches the filter, the unmatched log is not an error.
+func (s *FilterStore) StoreE(log *Log) error {
+	if !s.Filter.Match(log) {
+		return nil
+	}
+
+	return s.store.StoreE(log)
+}
+
+type filterNode interface {
+	eval(l *Log) interface{}
+}
+
+type filterOr struct{ x, y filterNode }
+
+func (n filterOr) eval(l *Log) interface{} {
+	return filterTruthy(n.x.eval(l)) || filterTruthy(n.y.eval(l))
+}
+
+type filterAnd struct{ x, y filterNode }
+
+func (n filterAnd) eval(l *Log) interface{} {
+	return filterTruthy(n.x.eval(l)) && filterTruthy(n.y.eval(l))
+}
+
+type filterNot struct{ x filterNode }
+
+func (n filterNot) eval(l *Log) interface{} { return !filterTruthy(n.x.eval(l)) }
+
+type filterLit struct{ v interface{} }
+
+func (n filterLit) eval(*Log) interface{} { return n.v }
+
+type filterCol struct{ col col }
+
+func (n filterCol) eval(l *Log) interface{} { return n.col.get(l) }
+
+type filterCmp struct {
+	op   string
+	x, y filterNode
+}
+
+func (n filterCmp) eval(l *Log) interface{} {
+	x, y := n.x.eval(l), n.y.eval(l)
+
+	if a, ok := filterNumber(x); ok {
+		if b, ok := filterNumber(y); ok {
+			return filterCompare(n.op, compareFloat(a, b))
+		}
+	}
+
+	return filterCompare(n.op, strings.Compare(filterString(x), filterString(y)))
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func filterCompare(op string, c int) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	default: // <=
+		return c <= 0
+	}
+}
+
+func filterNumber(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case uint64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func filterString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf("%v", x)
+	}
+}
+
+func filterTruthy(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case string:
+		return x != ""
+	case time.Time:
+		return !x.IsZero()
+	}
+
+	if f, ok := filterNumber(v); ok {
+		return f != 0
+	}
+
+	return true
+}
+
+const (
+	filterEOF = iota
+	filterIdent
+	filterStr
+	filterNum
+	filterOp
+)
+
+type filterToken struct {
+	kind int
+	text string
+	pos  int
+	v    interface{}
+}
+
+type filterParser struct {
+	expr   string
+	tokens []filterToken
+	i      int
+}
+
+func (p *filterParser) errorf(t filterToken, format string, args ...interface{}) error {
+	return fmt.Errorf("filter %q at %d: %s", p.expr, t.pos, fmt.Sprintf(format, args...))
+}
+
+func isFilterIdentChar(c byte, first bool) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+		!first && ('0' <= c && c <= '9' || c == '-' || c == '.' || c == '$')
+}
+
+// nolint:gochecknoglobals
+var filterOps = []string{"&&", "||", "==", "!=", ">=", "<=", ">", "<", "!", "(", ")"}
+
+func (p *filterParser) tokenize() error {
+	s := p.expr
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+
+			if j >= len(s) {
+				return p.errorf(filterToken{pos: i}, "unterminated string")
+			}
+
+			body := s[i+1 : j]
+			if c == '\'' {
+				body = strings.ReplaceAll(strings.ReplaceAll(body, `\'`, `'`), `"`, `\"`)
+			}
+
+			v, err := strconv.Unquote(`"` + body + `"`)
+			if err != nil {
+				return p.errorf(filterToken{pos: i}, "invalid string %s", s[i:j+1])
+			}
+
+			p.tokens = append(p.tokens, filterToken{kind: filterStr, text: s[i : j+1], pos: i, v: v})
+			i = j + 1
+		case '0' <= c && c <= '9' || c == '-' && i+1 < len(s) && '0' <= s[i+1] && s[i+1] <= '9':
+			j := i + 1
+			for ; j < len(s) && ('0' <= s[j] && s[j] <= '9' || s[j] == '.'); j++ {
+			}
+
+			f, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return p.errorf(filterToken{pos: i}, "invalid number %s", s[i:j])
+			}
+
+			p.tokens = append(p.tokens, filterToken{kind: filterNum, text: s[i:j], pos: i, v: f})
+			i = j
+		case isFilterIdentChar(c, true):
+			j := i + 1
+			for ; j < len(s) && isFilterIdentChar(s[j], false); j++ {
+			}
+
+			p.tokens = append(p.tokens, filterToken{kind: filterIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+
+			for _, o := range filterOps {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+
+			if op == "" {
+				return p.errorf(filterToken{pos: i}, "unexpected %c", c)
+			}
+
+			p.tokens = append(p.tokens, filterToken{kind: filterOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	p.tokens = append(p.tokens, filterToken{kind: filterEOF, text: "end", pos: len(s)})
+
+	return nil
+}
+
+func (p *filterParser) peek() filterToken { return p.tokens[p.i] }
+
+func (p *filterParser) next() filterToken {
+	t := p.tokens[p.i]
+	if t.kind != filterEOF {
+		p.i++
+	}
+
+	return t
+}
+
+func (p *filterParser) accept(op string) bool {
+	if t := p.peek(); t.kind == filterOp && t.text == op {
+		p.i++
+		return true
+	}
+
+	return false
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	x, err := p.parseAnd()
+
+	for err == nil && p.accept("||") {
+		var y filterNode
+		if y, err = p.parseAnd(); err == nil {
+			x = filterOr{x: x, y: y}
+		}
+	}
+
+	return x, err
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	x, err := p.parseUnary()
+
+	for err == nil && p.accept("&&") {
+		var y filterNode
+		if y, err = p.parseUnary(); err == nil {
+			x = filterAnd{x: x, y: y}
+		}
+	}
+
+	return x, err
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.accept("!") {
+		x, err := p.parseUnary()
+		return filterNot{x: x}, err
+	}
+
+	if p.accept("(") {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.accept(")") {
+			t := p.peek()
+			return nil, p.errorf(t, "expect ) but got %s", t.text)
+		}
+
+		return x, nil
+	}
+
+	x, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == filterOp {
+		switch t.text {
+		case "==", "!=", ">", ">=", "<", "<=":
+			p.next()
+
+			y, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+
+			return filterCmp{op: t.text, x: x, y: y}, nil
+		}
+	}
+
+	return x, nil
+}
+
+func (p *filterParser) parseOperand() (filterNode, error) {
+	t := p.next()
+
+	switch t.kind {
+	case filterStr, filterNum:
+		return filterLit{v: t.v}, nil
+	case filterIdent:
+		switch t.text {
+		case "true":
+			return filterLit{v: true}, nil
+		case "false":
+			return filterLit{v: false}, nil
+		}
+
+		c := TableCol{Name: t.text, Comment: `httplog:"` + t.text + `"`}
+		c.parseComment()
+
+		if c.ValueGetter == nil {
+			return nil, p.errorf(t, "unknown tag %s", t.text)
+		}
+
+		return filterCol{col: c.ValueGetter}, nil
+	default:
+		return nil, p.errorf(t, "expect an operand but got %s", t.text)
+	}
+}
@@ -0,0 +1,65 @@
+package httplog_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	l := &httplog.Log{Biz: "orders", RspStatus: 503, Duration: 800 * time.Millisecond,
+		ReqHeader: http.Header{"X-Debug": []string{"1"}}, Attrs: httplog.Attrs{"vip": true}}
+
+	cases := map[string]bool{
+		`rsp_status >= 400 && biz != "health"`:       true,
+		`rsp_status >= 400 && biz != 'orders'`:       false,
+		`cost > 500`:                                 true,
+		`cost > 500.5 && cost <= 800`:                true,
+		`req_head_X-Debug == "1"`:                    true,
+		`!(rsp_status < 500) || ctx_vip`:             true,
+		`!ctx_vip`:                                   false,
+		`ctx_user`:                                   false,
+		`ctx_vip == true && (biz == "a" || cost>-1)`: true,
+		`biz < "p"`:                                  true,
+	}
+
+	for expr, match := range cases {
+		f, err := httplog.CompileFilter(expr)
+		assert.Nil(t, err, expr)
+		assert.Equal(t, match, f.Match(l), expr)
+	}
+
+	for _, expr := range []string{
+		``,
+		`rsp_status >=`,
+		`(cost > 1`,
+		`cost > 1)`,
+		`unknown_tag == 1`,
+		`biz == "a`,
+		`biz = "a"`,
+	} {
+		_, err := httplog.CompileFilter(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func TestFilterStore(t *testing.T) {
+	errorLogs, slowLogs := make(chanStore, 1), make(chanStore, 1)
+	store := httplog.NewStores(
+		httplog.MustFilterStore(`rsp_status >= 400`, errorLogs),
+		httplog.MustFilterStore(`cost > 500`, slowLogs))
+
+	store.Store(&httplog.Log{ID: "1", RspStatus: 200, Duration: time.Second})
+	store.Store(&httplog.Log{ID: "2", RspStatus: 404})
+	store.Store(&httplog.Log{ID: "3", RspStatus: 200})
+
+	assert.Equal(t, "2", (<-errorLogs).ID)
+	assert.Equal(t, "1", (<-slowLogs).ID)
+	assert.Len(t, errorLogs, 0)
+	assert.Len(t, slowLogs, 0)
+
+	assert.Panics(t, func() { httplog.MustFilterStore(`cost >`, slowLogs) })
+}
@@ -0,0 +1,436 @@
+package httplog
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HAR is the HTTP Archive 1.2 document, see http://www.softwareishard.com/blog/har-12-spec/.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of the exported data.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator is the creator application of the HAR.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is an exported request.
+type HAREntry struct {
+	StartedDateTime string `json:"startedDateTime"`
+	// Time is the total elapsed time of the request in milliseconds.
+	Time     float64     `json:"time"`
+	Request  HARRequest  `json:"request"`
+	Response HARResponse `json:"response"`
+	Cache    struct{}    `json:"cache"`
+	Timings  HARTimings  `json:"timings"`
+	Comment  string      `json:"comment,omitempty"`
+}
+
+// HARRequest is the request of an entry.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse is the response of an entry.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARNameValue is a header, a query parameter or a cookie.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the request body.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARContent is the response body, Encoding is base64 for the binary body.
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are the timings in milliseconds, -1 for the ones not applicable.
+// The server side duration is recorded as wait.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// NewHAR returns the HAR document of the logs, like the ones loaded by LoadJSONLFile or LoadSQL.
+func NewHAR(logs []*Log) *HAR {
+	h := &HAR{Log: HARLog{Version: "1.2", Creator: harCreator(), Entries: make([]HAREntry, len(logs))}}
+
+	for i, l := range logs {
+		h.Log.Entries[i] = l.HAREntry()
+	}
+
+	return h
+}
+
+func harCreator() HARCreator { return HARCreator{Name: "httplog", Version: "1.0"} }
+
+// HAREntry returns the HAR entry of the log, with the values of SensitiveHeaders and their cookies redacted.
+func (l *Log) HAREntry() HAREntry {
+	started := l.Start
+	if started.IsZero() {
+		started = l.Created
+	}
+
+	ms := float64(l.Duration) / float64(time.Millisecond)
+	proto := "HTTP/1.1"
+
+	if l.Request != nil && l.Request.Proto != "" {
+		proto = l.Request.Proto
+	}
+
+	e := HAREntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            ms,
+		Request: HARRequest{
+			Method:      l.Method,
+			URL:         l.fullURL(),
+			HTTPVersion: proto,
+			Cookies:     harCookies("Cookie", (&http.Request{Header: l.ReqHeader}).Cookies()),
+			Headers:     harHeaders(l.ReqHeader),
+			QueryString: []HARNameValue{},
+			HeadersSize: -1,
+			BodySize:    l.ReqSize,
+		},
+		Response: HARResponse{
+			Status:      l.RspStatus,
+			StatusText:  http.StatusText(l.RspStatus),
+			HTTPVersion: proto,
+			Cookies:     harCookies("Set-Cookie", (&http.Response{Header: l.RspHeader}).Cookies()),
+			Headers:     harHeaders(l.RspHeader),
+			Content:     harContent(l),
+			RedirectURL: l.RspHeader.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    l.RespSize,
+		},
+		Timings: HARTimings{Blocked: -1, DNS: -1, Connect: -1, Wait: ms, SSL: -1},
+		Comment: l.Biz,
+	}
+
+	if u, err := url.Parse(l.URL); err == nil {
+		e.Request.QueryString = sortedValues(u.Query())
+	}
+
+	if l.ReqBody != "" || l.ReqSize > 0 {
+		e.Request.PostData = harPostData(l)
+	}
+
+	return e
+}
+
+func harPostData(l *Log) *HARPostData {
+	d := &HARPostData{MimeType: l.ReqHeader.Get("Content-Type"), Text: l.ReqBody}
+	binary, truncated := bodyState(l.ReqBody, l.ReqSize)
+
+	switch {
+	case binary:
+		d.Text = ""
+		d.Comment = "binary body of " + strconv.FormatInt(l.ReqSize, 10) + " bytes omitted"
+	case truncated:
+		d.Comment = "truncated to " + strconv.Itoa(len(l.ReqBody)) + " of " + strconv.FormatInt(l.ReqSize, 10) + " bytes"
+	}
+
+	return d
+}
+
+func harContent(l *Log) HARContent {
+	c := HARContent{Size: l.RespSize, MimeType: l.RspHeader.Get("Content-Type"), Text: l.RspBody}
+	binary, truncated := bodyState(l.RspBody, l.RespSize)
+
+	if binary {
+		c.Text = base64.StdEncoding.EncodeToString([]byte(l.RspBody))
+		c.Encoding = "base64"
+	}
+
+	if truncated {
+		c.Comment = "truncated to " + strconv.Itoa(len(l.RspBody)) + " of " + strconv.FormatInt(l.RespSize, 10) + " bytes"
+	}
+
+	return c
+}
+
+// harHeaders returns the headers sorted by the names, with the values of SensitiveHeaders redacted.
+func harHeaders(h http.Header) []HARNameValue {
+	result := sortedValues(url.Values(h))
+	for i, v := range result {
+		result[i].Value = redactHeader(v.Name, v.Value)
+	}
+
+	return result
+}
+
+func sortedValues(values map[string][]string) []HARNameValue {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	result := make([]HARNameValue, 0, len(values))
+
+	for _, name := range names {
+		for _, v := range values[name] {
+			result = append(result, HARNameValue{Name: name, Value: v})
+		}
+	}
+
+	return result
+}
+
+// harCookies returns the cookies parsed from the header, with the values redacted as the header.
+func harCookies(header string, cookies []*http.Cookie) []HARNameValue {
+	result := make([]HARNameValue, len(cookies))
+	for i, c := range cookies {
+		result[i] = HARNameValue{Name: c.Name, Value: redactHeader(header, c.Value)}
+	}
+
+	return result
+}
+
+// HAROption defines the option of HARStore.
+type HAROption struct {
+	// MaxEntries is the number of entries to rotate the file, default 1000.
+	MaxEntries int
+	// MaxSize is the size to rotate the file, 0 to disable the rotating by size.
+	MaxSize int64
+	// MaxBackups is the number of the rotated files to keep, 0 to keep all.
+	MaxBackups int
+}
+
+// HAROptionFn defines the function prototype to setting HAROption.
+type HAROptionFn func(o *HAROption)
+
+// HARMaxEntries set the number of entries to rotate the file.
+func HARMaxEntries(n int) HAROptionFn { return func(o *HAROption) { o.MaxEntries = n } }
+
+// HARMaxSize set the size to rotate the file.
+func HARMaxSize(size int64) HAROptionFn { return func(o *HAROption) { o.MaxSize = size } }
+
+// HARMaxBackups set the number of the rotated files to keep.
+func HARMaxBackups(n int) HAROptionFn { return func(o *HAROption) { o.MaxBackups = n } }
+
+// HARStore writes the logs as the entries of a HAR file, which is a valid HAR document after each write,
+// rotating the file like httplog-20210102T150405.000.har by the number of entries or the size.
+type HARStore struct {
+	path   string
+	option *HAROption
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	entries int
+	closed  bool
+}
+
+// harFooter closes the entries array and the document.
+const harFooter = "]}}\n"
+
+// NewHARStore creates a new HARStore writing to the file at path, the existing file is rotated first.
+func NewHARStore(path string, fns ...HAROptionFn) (*HARStore, error) {
+	option := &HAROption{MaxEntries: 1000}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	s := &HARStore{path: path, option: option}
+
+	if err := s.create(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// create moves the existing file away as a backup, and opens a new one.
+func (s *HARStore) create() error {
+	if fi, err := os.Stat(s.path); err == nil && fi.Size() > 0 {
+		if err := os.Rename(s.path, backupName(s.path, time.Now())); err != nil {
+			return err
+		}
+
+		if s.option.MaxBackups > 0 {
+			pruneBackups(s.path, s.option.MaxBackups)
+		}
+	}
+
+	return s.open()
+}
+
+// open creates the file with the empty entries.
+func (s *HARStore) open() error {
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	creator, _ := JSONMarshal(harCreator())
+	header := `{"log":{"version":"1.2","creator":` + string(creator) + `,"entries":[` + harFooter
+
+	if _, err := f.WriteString(header); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	s.file = f
+	s.size = int64(len(header))
+	s.entries = 0
+
+	return nil
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *HARStore) Store(log *Log) {
+	if err := s.StoreE(log); err != nil {
+		logrus.Warnf("failed to write log %s to %s, error: %v", log.ID, s.path, err)
+	}
+}
+
+// StoreE writes the entry of the log over the footer of the file, and writes the footer again.
+func (s *HARStore) StoreE(log *Log) error {
+	entry, err := JSONMarshal(log.HAREntry())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrDropped
+	}
+
+	if s.file != nil && s.entries > 0 && (s.entries >= s.option.MaxEntries ||
+		s.option.MaxSize > 0 && s.size+int64(len(entry)) > s.option.MaxSize) {
+		if err := s.rotate(); err != nil {
+			logrus.Warnf("failed to rotate %s, error: %v", s.path, err)
+		}
+	}
+
+	if s.file == nil {
+		if err := s.create(); err != nil {
+			return err
+		}
+	}
+
+	b := make([]byte, 0, len(entry)+len(harFooter)+1)
+	if s.entries > 0 {
+		b = append(b, ',')
+	}
+
+	b = append(append(b, entry...), harFooter...)
+	offset := s.size - int64(len(harFooter))
+
+	if _, err := s.file.WriteAt(b, offset); err != nil {
+		// restore the footer over the partially written entry.
+		if _, e := s.file.WriteAt([]byte(harFooter), offset); e == nil {
+			_ = s.file.Truncate(s.size)
+		}
+
+		return err
+	}
+
+	s.size += int64(len(b) - len(harFooter))
+	s.entries++
+
+	return nil
+}
+
+// rotate renames the file to a backup and opens a new one.
+// When the rename fails, the file is reopened to keep writing to it,
+// or s.file is nil to be created by the next write.
+func (s *HARStore) rotate() error {
+	_ = s.file.Close()
+	s.file = nil
+
+	if err := os.Rename(s.path, backupName(s.path, time.Now())); err != nil {
+		if f, e := os.OpenFile(s.path, os.O_WRONLY, 0o644); e == nil {
+			s.file = f
+		}
+
+		return err
+	}
+
+	if s.option.MaxBackups > 0 {
+		pruneBackups(s.path, s.option.MaxBackups)
+	}
+
+	return s.open()
+}
+
+// Close closes the file.
+func (s *HARStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+
+	if s.file == nil {
+		return nil
+	}
+
+	return s.file.Close()
+}
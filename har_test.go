@@ -0,0 +1,124 @@
+package httplog_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHAREntry(t *testing.T) {
+	start := time.Date(2021, 1, 2, 15, 4, 5, 0, time.UTC)
+	l := &httplog.Log{
+		ID: "1", Biz: "login", Method: "POST", URL: "/login?x=1&a=2",
+		ReqHeader: http.Header{"Content-Type": {"application/json"}, "Cookie": {"sid=abc"},
+			"Authorization": {"Bearer secret"}},
+		ReqBody: `{"name":"bingoo"}`, ReqSize: 100,
+		RspStatus: 404, RspHeader: http.Header{"Content-Type": {"image/png"}, "Set-Cookie": {"sid=def; Path=/"}},
+		RspBody: "\x89PNG\x00", RespSize: 5,
+		Start: start, Duration: 1500 * time.Microsecond,
+		Request: &http.Request{Host: "example.com", Proto: "HTTP/2.0"},
+	}
+
+	e := l.HAREntry()
+	assert.Equal(t, "2021-01-02T15:04:05Z", e.StartedDateTime)
+	assert.Equal(t, 1.5, e.Time)
+	assert.Equal(t, httplog.HARTimings{Blocked: -1, DNS: -1, Connect: -1, Wait: 1.5, SSL: -1}, e.Timings)
+	assert.Equal(t, "http://example.com/login?x=1&a=2", e.Request.URL)
+	assert.Equal(t, "HTTP/2.0", e.Request.HTTPVersion)
+	assert.Equal(t, []httplog.HARNameValue{{Name: "a", Value: "2"}, {Name: "x", Value: "1"}}, e.Request.QueryString)
+	assert.Equal(t, []httplog.HARNameValue{{Name: "sid", Value: "***"}}, e.Request.Cookies)
+	assert.Equal(t, []httplog.HARNameValue{{Name: "Authorization", Value: "***"},
+		{Name: "Content-Type", Value: "application/json"}, {Name: "Cookie", Value: "***"}}, e.Request.Headers)
+	assert.Equal(t, []httplog.HARNameValue{{Name: "sid", Value: "***"}}, e.Response.Cookies)
+	assert.Equal(t, []httplog.HARNameValue{{Name: "Content-Type", Value: "image/png"},
+		{Name: "Set-Cookie", Value: "***"}}, e.Response.Headers)
+	assert.Equal(t, "application/json", e.Request.PostData.MimeType)
+	assert.Equal(t, "truncated to 17 of 100 bytes", e.Request.PostData.Comment)
+	assert.Equal(t, "Not Found", e.Response.StatusText)
+	assert.Equal(t, "base64", e.Response.Content.Encoding)
+	assert.Equal(t, "iVBORwA=", e.Response.Content.Text)
+	assert.Empty(t, e.Response.Content.Comment)
+}
+
+func TestHARStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "har")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "httplog.har")
+	s, err := httplog.NewHARStore(path, httplog.HARMaxEntries(2), httplog.HARMaxBackups(1))
+	assert.Nil(t, err)
+
+	readHAR := func(name string) httplog.HAR {
+		content, err := ioutil.ReadFile(name)
+		assert.Nil(t, err)
+
+		var h httplog.HAR
+
+		assert.Nil(t, json.Unmarshal(content, &h))
+
+		return h
+	}
+
+	assert.Empty(t, readHAR(path).Log.Entries)
+
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		assert.Nil(t, s.StoreE(&httplog.Log{ID: id, Method: "GET", URL: "/" + id, RspStatus: 200, Start: time.Now()}))
+
+		h := readHAR(path)
+		assert.Equal(t, "1.2", h.Log.Version)
+		assert.Equal(t, "http://localhost/"+id, h.Log.Entries[len(h.Log.Entries)-1].Request.URL)
+	}
+
+	assert.Nil(t, s.Close())
+	assert.Len(t, readHAR(path).Log.Entries, 1)
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "httplog-*.har"))
+	assert.Len(t, backups, 1)
+	assert.Len(t, readHAR(backups[0]).Log.Entries, 2)
+
+	h := httplog.NewHAR([]*httplog.Log{{ID: "1", Method: "GET", URL: "https://a.b/c", RspStatus: 200}})
+	assert.Len(t, h.Log.Entries, 1)
+	assert.Equal(t, "https://a.b/c", h.Log.Entries[0].Request.URL)
+}
+
+func TestHARStoreRotateFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "har")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "logs", "httplog.har")
+	s, err := httplog.NewHARStore(path, httplog.HARMaxEntries(1))
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "1", URL: "/1"}))
+
+	// the rename of the rotation fails when the file is removed with its directory.
+	assert.Nil(t, os.RemoveAll(filepath.Join(dir, "logs")))
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "2", URL: "/2"}))
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "3", URL: "/3"}))
+	assert.Nil(t, s.Close())
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "logs", "httplog-*.har"))
+	assert.Len(t, backups, 1)
+
+	for name, url := range map[string]string{backups[0]: "http://localhost/2", path: "http://localhost/3"} {
+		content, err := ioutil.ReadFile(name)
+		assert.Nil(t, err)
+
+		var h httplog.HAR
+
+		assert.Nil(t, json.Unmarshal(content, &h))
+		assert.Len(t, h.Log.Entries, 1)
+		assert.Equal(t, url, h.Log.Entries[0].Request.URL)
+	}
+}
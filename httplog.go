@@ -1,6 +1,8 @@
 package httplog
 
 import (
+	"bufio"
+	"net"
 	"net/http"
 	"time"
 
@@ -24,6 +26,7 @@ func (mux *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	l.Option = holder.option
 	l.PathParams = holder.params
+	l.Route = holder.route
 	l.Biz = l.Option.GetBiz()
 
 	l.Method = r.Method
@@ -37,11 +40,39 @@ func (mux *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	l.ID = snow.Next().String()
+	trace := NewTraceContext(r)
+	l.TraceID, l.SpanID, l.ParentSpanID = trace.TraceID, trace.SpanID, trace.ParentSpanID
 	l.IPAddr = GetRemoteAddress(r)
-	l.ReqBody = string(PeekBody(r, maxSize))
+	l.ReqBody = string(PeekBody(r, mux.muxOption.MaxBodySize))
+
+	reqBody := &countingReadCloser{ReadCloser: r.Body}
+	if r.Body != nil {
+		r.Body = reqBody
+	}
 
 	newCtx, ctxVar := createCtx(r, l)
-	m := CaptureMetrics(mux.handler, w, r.WithContext(newCtx))
+	newCtx = ContextWithTrace(newCtx, trace)
+	rw := newResponseWriter(w, mux.muxOption.MaxBodySize)
+
+	var ws *wsConn
+
+	if IsWebSocketUpgrade(r) {
+		rw.onHijack = func(conn net.Conn, brw *bufio.ReadWriter) (net.Conn, *bufio.ReadWriter) {
+			handshakeDone := rw.wroteHeader && rw.code == http.StatusSwitchingProtocols
+			ws = newWsConn(conn, mux.muxOption.WsMessages, mux.muxOption.MaxBodySize, handshakeDone)
+
+			return ws, ws.wrapBufio(brw)
+		}
+	}
+
+	m := captureMetrics(rw, func(ww http.ResponseWriter) {
+		mux.handler.ServeHTTP(ww, r.WithContext(newCtx))
+	})
+
+	l.ReqSize = reqBody.n
+	if r.ContentLength > l.ReqSize {
+		l.ReqSize = r.ContentLength
+	}
 
 	l.RspStatus = m.Code
 	l.RspBody = m.RespBody
@@ -52,6 +83,20 @@ func (mux *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	l.RspHeader = m.Header
 	l.Attrs = ctxVar.Attrs
 
+	if ws != nil {
+		// the WebSocket session is logged once when its connection is closed.
+		ws.finish(func() {
+			ws.fill(l)
+			mux.storeLog(l)
+		})
+
+		return
+	}
+
+	mux.storeLog(l)
+}
+
+func (mux *Mux) storeLog(l *Log) {
 	if mux.store != nil {
 		mux.store.Store(l)
 	}
@@ -65,6 +110,10 @@ type HandlerFuncAware interface {
 // MuxOption defines the option of mux.
 type MuxOption struct {
 	IgnoreBizNoname bool
+	// MaxBodySize limits the bytes of the request and response bodies to be captured.
+	MaxBodySize int
+	// WsMessages is the number of the first WebSocket messages to be sampled in a session.
+	WsMessages int
 }
 
 // MuxOptionFn defines the function prototype to seting MuxOption.
@@ -77,9 +126,24 @@ func IgnoreBizNoname(ignore bool) MuxOptionFn {
 	}
 }
 
+// MaxBodySize set the max bytes of the request and response bodies to be captured.
+// The response is still sent to the client in full, as the handler writes it.
+func MaxBodySize(size int) MuxOptionFn {
+	return func(m *MuxOption) {
+		m.MaxBodySize = size
+	}
+}
+
+// WsSampleMessages set the number of the first WebSocket messages to be sampled in a session.
+func WsSampleMessages(n int) MuxOptionFn {
+	return func(m *MuxOption) {
+		m.WsMessages = n
+	}
+}
+
 // NewMux returns a new instance of Mux.
 func NewMux(handler http.Handler, store Store, muxOptions ...MuxOptionFn) *Mux {
-	muxOption := &MuxOption{}
+	muxOption := &MuxOption{MaxBodySize: maxSize}
 
 	for _, fn := range muxOptions {
 		fn(muxOption)
@@ -127,6 +191,7 @@ func (mux *Mux) registerRouter(method, pattern string, options []OptionFn) {
 		if ww, ok := w.(*OptionHolder); ok {
 			ww.option = option
 			ww.params = p
+			ww.route = pattern
 		}
 	}
 
@@ -6,8 +6,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"testing"
 
 	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
 )
 
 // from https://github.com/essentialbooks/books/blob/master/code/go/logging_http_requests/main.go
@@ -91,3 +93,21 @@ func handleJSON(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted) // 202
 	_, _ = w.Write([]byte(`{"name": "bingoohuang"}`))
 }
+
+func TestMaxBodySize(t *testing.T) {
+	logs := make(chanStore, 1)
+	mux := httplog.NewMux(http.NewServeMux(), logs, httplog.MaxBodySize(100000))
+	mux.HandleFunc("/echo", handleIndex, httplog.Biz("echo"))
+
+	body := strings.Repeat("x", 20000)
+	r, _ := http.NewRequest("POST", "/echo", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	assert.Equal(t, len(body), w.Body.Len())
+
+	l := <-logs
+	assert.Len(t, l.ReqBody, 20000)
+	assert.Equal(t, int64(20000), l.ReqSize)
+	assert.Len(t, l.RspBody, 20000)
+}
@@ -0,0 +1,334 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// InfluxWriter writes the points in the line protocol.
+type InfluxWriter interface {
+	// Write writes the lines, each ends with \n.
+	Write(lines []byte) error
+}
+
+// InfluxOption defines the option of InfluxStore.
+type InfluxOption struct {
+	// Measurement is the name of the measurement, default httplog.
+	Measurement string
+	// Attrs are the names of the context attributes written as fields, see PutAttr.
+	Attrs []string
+	// BatchSize is the max number of points in one write, default 1000.
+	BatchSize int
+	// FlushInterval is the max delay of a point waiting in the batch, default 1s.
+	FlushInterval time.Duration
+	// MaxBuffered is the max number of points waiting in the batch, the newer logs are dropped when full, default 10000.
+	MaxBuffered int
+	// Backoff retries the failed writes, default DefaultBackoff().
+	Backoff Backoff
+}
+
+// InfluxOptionFn defines the function prototype to setting InfluxOption.
+type InfluxOptionFn func(o *InfluxOption)
+
+// InfluxMeasurement set the name of the measurement.
+func InfluxMeasurement(name string) InfluxOptionFn {
+	return func(o *InfluxOption) { o.Measurement = name }
+}
+
+// InfluxAttrs set the names of the context attributes written as fields.
+func InfluxAttrs(names ...string) InfluxOptionFn { return func(o *InfluxOption) { o.Attrs = names } }
+
+// InfluxBatch set the max number of points in one write, and the max delay of a point.
+func InfluxBatch(size int, interval time.Duration) InfluxOptionFn {
+	return func(o *InfluxOption) {
+		o.BatchSize = size
+		o.FlushInterval = interval
+	}
+}
+
+// InfluxRetry set the backoff to retry the failed writes.
+func InfluxRetry(backoff Backoff) InfluxOptionFn {
+	return func(o *InfluxOption) { o.Backoff = backoff }
+}
+
+// InfluxStore writes the logs as the points of InfluxDB line protocol,
+// tagged by biz, method, status and route, with the fields cost (ms), req_size, rsp_size
+// and the selected context attributes, at the time of Start.
+type InfluxStore struct {
+	writer  InfluxWriter
+	option  *InfluxOption
+	batcher *batcher
+}
+
+// NewInfluxStore creates a new InfluxStore writing the points by the writer in batches.
+func NewInfluxStore(writer InfluxWriter, fns ...InfluxOptionFn) *InfluxStore {
+	option := &InfluxOption{
+		Measurement:   "httplog",
+		BatchSize:     1000,
+		FlushInterval: time.Second,
+		MaxBuffered:   10000,
+		Backoff:       DefaultBackoff(),
+	}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	s := &InfluxStore{writer: writer, option: option}
+	s.batcher = newBatcher(option.BatchSize, option.MaxBuffered, option.FlushInterval, s.write)
+
+	return s
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *InfluxStore) Store(log *Log) {
+	if err := s.StoreE(log); err != nil {
+		logrus.Warnf("failed to store log %s to influxdb, error: %v", log.ID, err)
+	}
+}
+
+// StoreE adds the point of the log to the batch, ErrDropped is returned when the batch is full or closed.
+func (s *InfluxStore) StoreE(log *Log) error {
+	return s.batcher.add(s.Line(log))
+}
+
+func (s *InfluxStore) write(items []interface{}) {
+	var b bytes.Buffer
+
+	for _, item := range items {
+		b.Write(item.([]byte))
+	}
+
+	if err := s.option.Backoff.Do(func() error { return s.writer.Write(b.Bytes()) }); err != nil {
+		logrus.Warnf("failed to write %d points to influxdb, error: %v", len(items), err)
+	}
+}
+
+// Close stops accepting logs, and writes the points in the batch until ctx is done.
+func (s *InfluxStore) Close(ctx context.Context) error {
+	err := s.batcher.close(ctx)
+
+	if c, ok := s.writer.(interface{ Close() error }); ok {
+		if e := c.Close(); err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// Line returns the point of the log in line protocol, ending with \n.
+func (s *InfluxStore) Line(l *Log) []byte {
+	var b bytes.Buffer
+
+	b.WriteString(influxEscape(s.option.Measurement, ", "))
+
+	tags := [][2]string{{"biz", l.Biz}, {"method", l.Method}, {"route", l.Route}, {"status", strconv.Itoa(l.RspStatus)}}
+	for _, tag := range tags {
+		if tag[1] != "" {
+			b.WriteString("," + tag[0] + "=" + influxEscape(tag[1], ",= "))
+		}
+	}
+
+	fmt.Fprintf(&b, " cost=%di,req_size=%di,rsp_size=%di", l.Duration.Milliseconds(), l.ReqSize, l.RespSize)
+
+	names := append([]string(nil), s.option.Attrs...)
+	sort.Strings(names)
+
+	for _, name := range names {
+		if v, ok := influxField(l.Attrs[name]); ok {
+			b.WriteString("," + influxEscape(name, ",= ") + "=" + v)
+		}
+	}
+
+	t := l.Start
+	if t.IsZero() {
+		t = l.Created
+	}
+
+	if !t.IsZero() {
+		b.WriteString(" " + strconv.FormatInt(t.UnixNano(), 10))
+	}
+
+	b.WriteByte('\n')
+
+	return b.Bytes()
+}
+
+// influxEscape escapes the chars and the backslash by backslash.
+func influxEscape(s, chars string) string {
+	if !strings.ContainsAny(s, chars+"\\\n") {
+		return s
+	}
+
+	var b strings.Builder
+
+	for _, c := range s {
+		switch {
+		case c == '\n':
+			b.WriteString(`\n`)
+			continue
+		case c == '\\' || strings.ContainsRune(chars, c):
+			b.WriteByte('\\')
+		}
+
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+// influxField formats the field value, false is returned for nil.
+func influxField(v interface{}) (string, bool) {
+	switch x := v.(type) {
+	case nil:
+		return "", false
+	case bool:
+		return strconv.FormatBool(x), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%di", x), true
+	case float32, float64:
+		return fmt.Sprintf("%v", x), true
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(x) + `"`, true
+	default:
+		return influxField(fmt.Sprintf("%v", x))
+	}
+}
+
+// InfluxHTTP writes the points by the HTTP write API.
+type InfluxHTTP struct {
+	URL    string
+	Header http.Header
+	Client *http.Client
+}
+
+// NewInfluxHTTP creates a new InfluxHTTP writing to the url,
+// like http://127.0.0.1:8086/api/v2/write?org=my-org&bucket=my-bucket (2.x)
+// or http://127.0.0.1:8086/write?db=mydb (1.x), with the token for 2.x if it is not empty.
+func NewInfluxHTTP(url, token string) *InfluxHTTP {
+	w := &InfluxHTTP{URL: url, Header: make(http.Header), Client: &http.Client{Timeout: 10 * time.Second}}
+
+	if token != "" {
+		w.Header.Set("Authorization", "Token "+token)
+	}
+
+	return w
+}
+
+// Write posts the lines.
+func (w *InfluxHTTP) Write(lines []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(lines))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range w.Header {
+		req.Header[k] = v
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	rsp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer rsp.Body.Close()
+
+	content, _ := ioutil.ReadAll(rsp.Body)
+
+	if rsp.StatusCode >= 300 {
+		return fmt.Errorf("influxdb write status %d: %s", rsp.StatusCode, Abbreviate(string(content), 200))
+	}
+
+	return nil
+}
+
+// influxUDPPayload is the max payload of a UDP packet.
+const influxUDPPayload = 8192
+
+// InfluxUDP writes the points by UDP packets.
+type InfluxUDP struct {
+	conn net.Conn
+}
+
+// NewInfluxUDP creates a new InfluxUDP writing to the address, like 127.0.0.1:8089.
+func NewInfluxUDP(addr string) (*InfluxUDP, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InfluxUDP{conn: conn}, nil
+}
+
+// Write sends the lines by packets split at the line boundaries.
+func (w *InfluxUDP) Write(lines []byte) error {
+	for len(lines) > 0 {
+		n := len(lines)
+
+		if n > influxUDPPayload {
+			if n = bytes.LastIndexByte(lines[:influxUDPPayload], '\n') + 1; n <= 0 {
+				n = bytes.IndexByte(lines, '\n') + 1
+			}
+		}
+
+		if _, err := w.conn.Write(lines[:n]); err != nil {
+			return err
+		}
+
+		lines = lines[n:]
+	}
+
+	return nil
+}
+
+// Close closes the UDP connection.
+func (w *InfluxUDP) Close() error { return w.conn.Close() }
+
+// InfluxFile appends the points to a file, e.g. for telegraf tail input.
+type InfluxFile struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewInfluxFile opens the file for appending the points.
+func NewInfluxFile(path string) (*InfluxFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InfluxFile{file: f}, nil
+}
+
+// Write appends the lines.
+func (w *InfluxFile) Write(lines []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err := w.file.Write(lines)
+
+	return err
+}
+
+// Close closes the file.
+func (w *InfluxFile) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
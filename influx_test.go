@@ -0,0 +1,54 @@
+package httplog_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfluxStore(t *testing.T) {
+	logs := make(chanStore, 1)
+	router := httplog.NewGin(gin.New(), logs)
+	router.POST("/hello/:name", func(c *gin.Context) { c.String(200, "hello "+c.Param("name")) },
+		httplog.Biz("say hello"))
+
+	r, _ := http.NewRequest("POST", "/hello/bingoo", strings.NewReader("0123456789"))
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	l := <-logs
+	assert.Equal(t, "/hello/:name", l.Route)
+	assert.Equal(t, int64(10), l.ReqSize)
+	assert.Equal(t, int64(12), l.RespSize)
+
+	l.Start = time.Unix(1, 2)
+	l.Duration = 3 * time.Millisecond
+	l.Attrs = httplog.Attrs{"user": `a "b"`, "vip": true, "ignored": 1}
+
+	var body string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	store := httplog.NewInfluxStore(httplog.NewInfluxHTTP(server.URL+"/api/v2/write?bucket=b", "secret"),
+		httplog.InfluxAttrs("vip", "user"), httplog.InfluxBatch(10, time.Hour))
+	assert.Nil(t, store.StoreE(l))
+	assert.Nil(t, store.Close(context.Background()))
+
+	assert.Equal(t, `httplog,biz=say\ hello,method=POST,route=/hello/:name,status=200 `+
+		`cost=3i,req_size=10i,rsp_size=12i,user="a \"b\"",vip=true 1000000002`+"\n", body)
+}
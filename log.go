@@ -2,6 +2,8 @@ package httplog
 
 import (
 	"net/http"
+	"net/url"
+	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -14,13 +16,24 @@ type Log struct {
 	ID  string
 	Biz string
 
+	// TraceID is the W3C trace ID of the request, 32 lowercase hex digits.
+	TraceID string
+	// SpanID is the span ID of the request, 16 lowercase hex digits.
+	SpanID string
+	// ParentSpanID is the span ID from the incoming traceparent header, empty when a new trace is started.
+	ParentSpanID string
+
 	// Method is GET etc.
 	Method string
 	URL    string
+	// Route is the registered route pattern, like /hello/:name.
+	Route  string
 	IPAddr string
 
 	RspHeader http.Header
 	ReqBody   string
+	// ReqSize is number of bytes of the request body.
+	ReqSize int64
 
 	// RspStatus, like 200, 404.
 	RspStatus int
@@ -41,9 +54,19 @@ type Log struct {
 	Duration time.Duration
 	Attrs    Attrs
 
+	// SampleRate is the sample rate of the log kept by SamplingStore, 0 when it is not sampled.
+	SampleRate float64
+
+	// Ws records the WebSocket session statistics, nil for the non-WebSocket requests.
+	Ws *WsSession
+
 	Option     *Option
 	PathParams httprouter.Params
 	Request    *http.Request
+
+	// truncated are the tags of the request values which may be truncated by the column max lengths,
+	// set by LoadSQL, or of the truncated or binary request body, set by LoadJSONL, the log is not replayed then.
+	truncated []string
 }
 
 func (l *Log) pathVar(name string) string {
@@ -67,21 +90,65 @@ func (l *Log) pathVars() interface{} {
 }
 
 func (l *Log) queryVar(name string) string {
+	if l.Request == nil {
+		return ""
+	}
+
 	return At(l.Request.URL.Query()[name], 0)
 }
 
 func (l *Log) queryVars() string {
+	if l.Request == nil {
+		return ""
+	}
+
 	return l.Request.URL.Query().Encode()
 }
 
 func (l *Log) paramVar(name string) string {
+	if l.Request == nil {
+		return ""
+	}
+
 	return At(l.Request.Form[name], 0)
 }
 
 func (l *Log) paramVars() string {
+	if l.Request == nil {
+		return ""
+	}
+
 	return l.Request.Form.Encode()
 }
 
+// fullURL returns the absolute URL of the request, with the scheme by TLS or X-Forwarded-Proto, and the host.
+func (l *Log) fullURL() string {
+	u, err := url.Parse(l.URL)
+	if err != nil || u.IsAbs() {
+		return l.URL
+	}
+
+	u.Scheme, u.Host = "http", l.ReqHeader.Get("Host")
+
+	if r := l.Request; r != nil {
+		u.Host = r.Host
+
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+
+	if proto := l.ReqHeader.Get("X-Forwarded-Proto"); proto != "" {
+		u.Scheme = proto
+	}
+
+	if u.Host == "" {
+		u.Host = "localhost"
+	}
+
+	return u.String()
+}
+
 // Store defines the interface to Store a log.
 type Store interface {
 	// Store stores the log in database like MySQL, InfluxDB, and etc.
@@ -104,15 +171,63 @@ func (s *LogrusStore) Store(log *Log) {
 // Stores is the composite stores.
 type Stores struct {
 	Composite []Store
+
+	// Backoff, if not nil, retries the stores implementing StoreE on failures.
+	Backoff *Backoff
+	// DeadLetter, if not nil, receives the logs which a store still fails to store after the retries.
+	DeadLetter Store
+
+	// Parallel stores the log into the stores concurrently, the stores should not modify the log then.
+	Parallel bool
+	// Timeout, if positive in parallel mode, limits the waiting for each store,
+	// the slow store goes on in background without delaying the caller.
+	Timeout time.Duration
+
+	healthMu sync.Mutex
+	health   []*storeHealth
 }
 
 // Store stores the log in database like MySQL, InfluxDB, and etc.
 func (s *Stores) Store(log *Log) {
-	for _, v := range s.Composite {
-		v.Store(log)
+	if err := s.StoreE(log); err != nil {
+		logrus.Warnf("failed to store log %s, error: %v", log.ID, err)
 	}
 }
 
+// StoreE stores the log into all the stores, and returns the errors of the failed ones.
+// The panic of a store is recovered and returned as its error.
+func (s *Stores) StoreE(log *Log) error {
+	if s.Parallel {
+		return s.storeParallel(log)
+	}
+
+	var errs Errors
+
+	for i, v := range s.Composite {
+		if err := s.storeInto(s.sink(i, v), v, log); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.Err()
+}
+
+// WithRetry set the backoff to retry the failed stores, and the dead letter store for the logs still failing.
+func (s *Stores) WithRetry(backoff Backoff, deadLetter Store) *Stores {
+	s.Backoff = &backoff
+	s.DeadLetter = deadLetter
+
+	return s
+}
+
+// WithParallel set the stores to store concurrently, and the timeout of waiting for each store.
+func (s *Stores) WithParallel(timeout time.Duration) *Stores {
+	s.Parallel = true
+	s.Timeout = timeout
+
+	return s
+}
+
 // NewStores composes the stores as a Store.
 func NewStores(stores ...Store) *Stores {
 	return &Stores{Composite: stores}
@@ -0,0 +1,116 @@
+package httplog
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldMapping maps the field names of a document to the tags of the log values,
+// the tags are the same as the ones in the comments of the log table columns,
+// like {"biz": "biz", "user": "ctx_user", "name": "req_json_name", "ua": "req_head_User-Agent"}.
+type FieldMapping map[string]string
+
+// DefaultFieldMapping returns the mapping of the common fields.
+func DefaultFieldMapping() FieldMapping {
+	return FieldMapping{
+		"id":         "id",
+		"created":    "created",
+		"started":    "started",
+		"end":        "end",
+		"cost":       "cost",
+		"biz":        "biz",
+		"ip":         "ip",
+		"hostname":   "hostname",
+		"pid":        "pid",
+		"addr":       "addr",
+		"req_method": "req_method",
+		"req_url":    "req_url",
+		"req_body":   "req_body",
+		"rsp_status": "rsp_status",
+		"rsp_body":   "rsp_body",
+	}
+}
+
+type fieldGetter struct {
+	name string
+	col  col
+}
+
+// fieldGetters gets the fields of a document from a log.
+type fieldGetters []fieldGetter
+
+// compile creates the value getters of the fields, the fields with unknown tags are ignored with warnings.
+func (m FieldMapping) compile() fieldGetters {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	getters := make(fieldGetters, 0, len(m))
+
+	for _, name := range names {
+		c := TableCol{Name: name, Comment: `httplog:"` + m[name] + `"`}
+		c.parseComment()
+
+		if c.ValueGetter == nil {
+			logrus.Warnf("unknown tag %s for field %s", m[name], name)
+			continue
+		}
+
+		getters = append(getters, fieldGetter{name: name, col: c.ValueGetter})
+	}
+
+	return getters
+}
+
+// document returns the fields of the log, the nil values are omitted.
+func (g fieldGetters) document(l *Log) map[string]interface{} {
+	doc := make(map[string]interface{}, len(g))
+
+	for _, f := range g {
+		if v := f.col.get(l); v != nil {
+			doc[f.name] = v
+		}
+	}
+
+	return doc
+}
+
+// writeJSON writes the JSON object of the fields in the order of g, unlike the random order of document.
+func (g fieldGetters) writeJSON(b *bytes.Buffer, l *Log) error {
+	b.WriteByte('{')
+
+	sep := false
+
+	for _, f := range g {
+		v := f.col.get(l)
+		if v == nil {
+			continue
+		}
+
+		name, _ := JSONMarshal(f.name)
+
+		value, err := JSONMarshal(v)
+		if err != nil {
+			return err
+		}
+
+		if sep {
+			b.WriteByte(',')
+		}
+
+		sep = true
+
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+
+	b.WriteByte('}')
+
+	return nil
+}
@@ -2,7 +2,6 @@ package httplog
 
 import (
 	"net/http"
-	"net/http/httptest"
 	"time"
 )
 
@@ -23,9 +22,12 @@ type Metrics struct {
 	// rowsData to their underlying connection directly (e.g. headers), but those
 	// are not tracked. Therefore the number of Written bytes will usually match
 	// the size of the response body.
-	Written  int64
+	Written int64
+	// RespBody is the head of the response body, limited to the max body size.
 	RespBody string
 	Header   http.Header
+	// Hijacked tells whether the handler took over the connection by http.Hijacker.
+	Hijacked bool
 }
 
 // CaptureMetrics wraps the given hnd, executes it with the given w and r, and
@@ -41,28 +43,25 @@ func CaptureMetrics(hnd http.Handler, w http.ResponseWriter, r *http.Request) Me
 // sugar on top of this func), but is a more usable interface if your
 // application doesn't use the Go http.Handler interface.
 func CaptureMetricsFn(w http.ResponseWriter, fn func(http.ResponseWriter)) Metrics {
+	return captureMetrics(newResponseWriter(w, maxSize), fn)
+}
+
+// captureMetrics passes the writes of fn through to the writer wrapped by rw,
+// capturing at most rw.maxBody bytes of the response body.
+// The wrapped writer keeps the http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom
+// abilities of w, so streaming responses like SSE and chunked downloads work as usual.
+func captureMetrics(rw *responseWriter, fn func(http.ResponseWriter)) Metrics {
 	m := Metrics{Start: time.Now()}
-	rec := httptest.NewRecorder()
 
-	fn(rec)
+	fn(rw.wrap())
 
 	m.End = time.Now()
 	m.Duration = m.End.Sub(m.Start)
-	m.Code = rec.Code
-
-	if rec.Body.Len() <= maxSize {
-		m.RespBody = rec.Body.String()
-	} else {
-		m.RespBody = string(rec.Body.Bytes()[:maxSize-3]) + "..."
-	}
-
-	for k, v := range rec.Header() {
-		w.Header()[k] = v
-	}
-
-	w.WriteHeader(rec.Code)
-	m.Written, _ = rec.Body.WriteTo(w)
-	m.Header = rec.Header()
+	m.Code = rw.code
+	m.Written = rw.written
+	m.RespBody = rw.respBody()
+	m.Header = rw.Header()
+	m.Hijacked = rw.hijacked
 
 	return m
 }
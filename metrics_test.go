@@ -1,6 +1,7 @@
 package httplog_test
 
 import (
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -107,3 +108,63 @@ func errContains(err error, s string) bool {
 
 	return strings.Contains(errS, s)
 }
+
+func TestCaptureMetricsStreaming(t *testing.T) {
+	chunk := make(chan struct{})
+	ch := make(chan httplog.Metrics, 1)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ch <- httplog.CaptureMetrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			f, ok := w.(http.Flusher)
+			if !ok {
+				t.Error("http.Flusher is not exposed")
+				return
+			}
+
+			if _, ok := w.(http.Hijacker); !ok {
+				t.Error("http.Hijacker is not exposed")
+			}
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("data: first\n\n"))
+			f.Flush()
+			<-chunk
+			_, _ = w.Write([]byte(strings.Repeat("x", 5000)))
+		}), w, r)
+	})
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	first := make([]byte, len("data: first\n\n"))
+	if _, err := io.ReadFull(res.Body, first); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(first) != "data: first\n\n" {
+		t.Errorf("got=%q before the handler finished", first)
+	}
+
+	close(chunk)
+
+	rest, _ := ioutil.ReadAll(res.Body)
+	m := <-ch
+
+	switch {
+	case len(rest) != 5000:
+		t.Errorf("got=%d want=%d", len(rest), 5000)
+	case m.Written != int64(len(first)+len(rest)):
+		t.Errorf("got=%d want=%d", m.Written, len(first)+len(rest))
+	case len(m.RespBody) != 3000 || !strings.HasSuffix(m.RespBody, "..."):
+		t.Errorf("got=%d bytes body, want 3000 bytes ending with ...", len(m.RespBody))
+	case m.Header.Get("Content-Type") != "text/event-stream":
+		t.Errorf("got=%s want=text/event-stream", m.Header.Get("Content-Type"))
+	}
+}
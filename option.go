@@ -13,6 +13,7 @@ type OptionFns []OptionFn
 type OptionHolder struct {
 	option *Option
 	params httprouter.Params
+	route  string
 }
 
 // Header returns the header map that will be sent by WriteHeader.
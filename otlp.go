@@ -0,0 +1,270 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OTLPOption defines the option of OTLPStore.
+type OTLPOption struct {
+	// ServiceName is the service.name resource attribute, default httplog.
+	ServiceName string
+	// BatchSize is the max number of spans in one export request, default 100.
+	BatchSize int
+	// FlushInterval is the max delay of a span waiting in the batch, default 1s.
+	FlushInterval time.Duration
+	// MaxBuffered is the max number of spans waiting in the batch, the newer logs are dropped when full, default 10000.
+	MaxBuffered int
+	// Backoff retries the failed export requests, default DefaultBackoff().
+	Backoff Backoff
+	// Header is the additional header of the export requests.
+	Header http.Header
+	// Client is the client to send the export requests, default with timeout 10s.
+	Client *http.Client
+}
+
+// OTLPOptionFn defines the function prototype to setting OTLPOption.
+type OTLPOptionFn func(o *OTLPOption)
+
+// OTLPServiceName set the service.name resource attribute.
+func OTLPServiceName(name string) OTLPOptionFn {
+	return func(o *OTLPOption) { o.ServiceName = name }
+}
+
+// OTLPBatch set the max number of spans in one export request, and the max delay of a span.
+func OTLPBatch(size int, interval time.Duration) OTLPOptionFn {
+	return func(o *OTLPOption) {
+		o.BatchSize = size
+		o.FlushInterval = interval
+	}
+}
+
+// OTLPRetry set the backoff to retry the failed export requests.
+func OTLPRetry(backoff Backoff) OTLPOptionFn {
+	return func(o *OTLPOption) { o.Backoff = backoff }
+}
+
+// OTLPHeader set an additional header of the export requests.
+func OTLPHeader(key, value string) OTLPOptionFn {
+	return func(o *OTLPOption) { o.Header.Set(key, value) }
+}
+
+// OTLPStore exports the logs as server spans to an OpenTelemetry collector by OTLP/HTTP JSON,
+// the logs without TraceID are ignored.
+type OTLPStore struct {
+	url     string
+	option  *OTLPOption
+	batcher *batcher
+}
+
+// NewOTLPStore creates a new OTLPStore exporting to the url, like http://127.0.0.1:4318/v1/traces.
+func NewOTLPStore(url string, fns ...OTLPOptionFn) *OTLPStore {
+	option := &OTLPOption{
+		ServiceName:   "httplog",
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		MaxBuffered:   10000,
+		Backoff:       DefaultBackoff(),
+		Header:        make(http.Header),
+		Client:        &http.Client{Timeout: 10 * time.Second},
+	}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	s := &OTLPStore{url: url, option: option}
+	s.batcher = newBatcher(option.BatchSize, option.MaxBuffered, option.FlushInterval, s.export)
+
+	return s
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *OTLPStore) Store(log *Log) {
+	if err := s.StoreE(log); err != nil {
+		logrus.Warnf("failed to export log %s to %s, error: %v", log.ID, s.url, err)
+	}
+}
+
+// StoreE adds the span of the log to the batch, ErrDropped is returned when the batch is full or closed.
+func (s *OTLPStore) StoreE(log *Log) error {
+	if log.TraceID == "" {
+		return nil
+	}
+
+	return s.batcher.add(Span(log))
+}
+
+// Close stops accepting logs, and exports the spans in the batch until ctx is done.
+func (s *OTLPStore) Close(ctx context.Context) error {
+	return s.batcher.close(ctx)
+}
+
+func (s *OTLPStore) export(items []interface{}) {
+	spans := make([]OTLPSpan, len(items))
+	for i, item := range items {
+		spans[i] = item.(OTLPSpan)
+	}
+
+	body, err := JSONMarshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []OTLPAttr{otlpString("service.name", s.option.ServiceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "httplog"}, Spans: spans}},
+	}}})
+	if err != nil {
+		logrus.Warnf("failed to marshal %d spans, error: %v", len(spans), err)
+		return
+	}
+
+	if err := s.option.Backoff.Do(func() error { return s.post(body) }); err != nil {
+		logrus.Warnf("failed to export %d spans to %s, error: %v", len(spans), s.url, err)
+	}
+}
+
+func (s *OTLPStore) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range s.option.Header {
+		req.Header[k] = v
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rsp, err := s.option.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer rsp.Body.Close()
+
+	content, _ := ioutil.ReadAll(rsp.Body)
+
+	if rsp.StatusCode >= 300 {
+		return fmt.Errorf("otlp export status %d: %s", rsp.StatusCode, Abbreviate(string(content), 200))
+	}
+
+	return nil
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []OTLPAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []OTLPSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+// OTLPSpan is the span in the OTLP/HTTP JSON encoding.
+type OTLPSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []OTLPAttr `json:"attributes"`
+	Status            OTLPStatus `json:"status"`
+}
+
+// OTLPAttr is the key value attribute of a span.
+type OTLPAttr struct {
+	Key   string        `json:"key"`
+	Value OTLPAttrValue `json:"value"`
+}
+
+// OTLPAttrValue is the value of an attribute, int64 is encoded as a string.
+type OTLPAttrValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+// OTLPStatus is the status of a span, code 2 for error.
+type OTLPStatus struct {
+	Code int `json:"code,omitempty"`
+}
+
+const (
+	otlpSpanKindServer  = 2
+	otlpStatusCodeError = 2
+)
+
+func otlpString(key, value string) OTLPAttr {
+	return OTLPAttr{Key: key, Value: OTLPAttrValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int64) OTLPAttr {
+	v := strconv.FormatInt(value, 10)
+	return OTLPAttr{Key: key, Value: OTLPAttrValue{IntValue: &v}}
+}
+
+// Span returns the server span of the log, named by the method and the route, or the path without route.
+func Span(l *Log) OTLPSpan {
+	path := l.URL
+	if p := strings.IndexByte(path, '?'); p >= 0 {
+		path = path[:p]
+	}
+
+	name := l.Route
+	if name == "" {
+		name = path
+	}
+
+	attrs := []OTLPAttr{
+		otlpString("http.request.method", l.Method),
+		otlpString("url.path", path),
+		otlpInt("http.response.status_code", int64(l.RspStatus)),
+		otlpInt("http.request.body.size", l.ReqSize),
+		otlpInt("http.response.body.size", l.RespSize),
+		otlpString("httplog.id", l.ID),
+	}
+
+	if l.Route != "" {
+		attrs = append(attrs, otlpString("http.route", l.Route))
+	}
+
+	if l.Biz != "" {
+		attrs = append(attrs, otlpString("httplog.biz", l.Biz))
+	}
+
+	span := OTLPSpan{
+		TraceID:           l.TraceID,
+		SpanID:            l.SpanID,
+		ParentSpanID:      l.ParentSpanID,
+		Name:              strings.TrimSpace(l.Method + " " + name),
+		Kind:              otlpSpanKindServer,
+		StartTimeUnixNano: strconv.FormatInt(l.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(l.End.UnixNano(), 10),
+		Attributes:        attrs,
+	}
+
+	if l.RspStatus >= 500 {
+		span.Status.Code = otlpStatusCodeError
+	}
+
+	return span
+}
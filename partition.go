@@ -0,0 +1,178 @@
+package httplog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// nolint:gochecknoglobals
+var (
+	partitionPattern = regexp.MustCompile(`\$\{(\w+)\}`)
+	partitionLayout  = strings.NewReplacer("yyyy", "2006", "yy", "06", "MM", "01", "dd", "02", "HH", "15")
+)
+
+// IsPartitioned tells whether the table name contains time placeholders like ${yyyyMM}.
+func IsPartitioned(table string) bool { return partitionPattern.MatchString(table) }
+
+// PartitionName resolves the time placeholders in the table name by t,
+// like biz_log_${yyyyMM} to biz_log_202101, the supported placeholders are
+// composed of yyyy, yy, MM, dd and HH.
+func PartitionName(table string, t time.Time) string {
+	return partitionPattern.ReplaceAllStringFunc(table, func(s string) string {
+		return t.Format(partitionLayout.Replace(s[2 : len(s)-1]))
+	})
+}
+
+// partitionRange parses the time in the name of a partition of the table name pattern,
+// and returns the time range covered by the partition, like [2021-01-01, 2021-02-01) for biz_log_202101.
+func partitionRange(table, name string) (start, end time.Time, ok bool) {
+	var expr, layout strings.Builder
+
+	expr.WriteString("^")
+
+	last := 0
+
+	for _, loc := range partitionPattern.FindAllStringSubmatchIndex(table, -1) {
+		l := partitionLayout.Replace(table[loc[2]:loc[3]])
+		expr.WriteString(regexp.QuoteMeta(table[last:loc[0]]))
+		expr.WriteString(`(\d{` + strconv.Itoa(len(l)) + `})`)
+		layout.WriteString(l)
+
+		last = loc[1]
+	}
+
+	expr.WriteString(regexp.QuoteMeta(table[last:]) + "$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return start, end, false
+	}
+
+	sub := re.FindStringSubmatch(name)
+	if sub == nil {
+		return start, end, false
+	}
+
+	start, err = time.ParseInLocation(layout.String(), strings.Join(sub[1:], ""), time.Local)
+	if err != nil {
+		return start, end, false
+	}
+
+	switch l := layout.String(); {
+	case strings.Contains(l, "15"):
+		end = start.Add(time.Hour)
+	case strings.Contains(l, "02"):
+		end = start.AddDate(0, 0, 1)
+	case strings.Contains(l, "01"):
+		end = start.AddDate(0, 1, 0)
+	default:
+		end = start.AddDate(1, 0, 0)
+	}
+
+	return start, end, true
+}
+
+// templateName returns the template table of the partitioned table name pattern,
+// which is the pattern without the placeholders and the separators before them.
+func templateName(table string) string {
+	return strings.TrimRight(partitionPattern.ReplaceAllString(table, ""), "_-$")
+}
+
+// PartitionTemplate sets the template table of the partitioned table name pattern.
+func (s *SQLStore) PartitionTemplate(table, template string) *SQLStore {
+	s.schemaMu.Lock()
+	defer s.schemaMu.Unlock()
+
+	if s.Templates == nil {
+		s.Templates = make(map[string]string)
+	}
+
+	s.Templates[table] = template
+
+	return s
+}
+
+// resolveTable resolves the table name by the time of the log creation when it is partitioned,
+// and remembers the template of the partition.
+func (s *SQLStore) resolveTable(table string, created time.Time) string {
+	if !IsPartitioned(table) {
+		return table
+	}
+
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	name := PartitionName(table, created)
+
+	s.schemaMu.RLock()
+	_, ok := s.partitions[name]
+	s.schemaMu.RUnlock()
+
+	if ok {
+		return name
+	}
+
+	template := s.templateOf(table)
+
+	s.schemaMu.Lock()
+	defer s.schemaMu.Unlock()
+
+	if s.partitions == nil {
+		s.partitions = make(map[string]string)
+	}
+
+	s.partitions[name] = template
+
+	return name
+}
+
+// queryPartitionSchema creates the partition like the template table when it does not exist,
+// and returns the schema by the column mapping of the template table, limited to the columns of the partition,
+// since the partitions created before an ALTER TABLE of the template lack the new columns.
+func (s *SQLStore) queryPartitionSchema(name, template string, refresh bool) (*tableSchema, error) {
+	ts, err := s.doLoadTableSchema(template, refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ts.ValueGetters) == 0 {
+		logrus.Warnf("template table %s of partition %s has no log columns", template, name)
+		return ts.withName(name), nil
+	}
+
+	if err := s.Dialect.CreateTableLike(s.DB, name, template); err != nil {
+		return nil, err
+	}
+
+	cols, err := s.Dialect.LoadColumns(s.DB, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.withColumns(name, cols), nil
+}
+
+// templateOf returns the template table of the partitioned table name pattern.
+func (s *SQLStore) templateOf(table string) string {
+	s.schemaMu.RLock()
+	defer s.schemaMu.RUnlock()
+
+	if template, ok := s.Templates[table]; ok {
+		return template
+	}
+
+	return templateName(table)
+}
+
+// forgetTable removes the table from the schema cache, e.g. after the partition is dropped.
+func (s *SQLStore) forgetTable(name string) {
+	s.schemaMu.Lock()
+	delete(s.TableCols, name)
+	delete(s.partitions, name)
+	s.schemaMu.Unlock()
+}
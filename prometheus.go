@@ -0,0 +1,317 @@
+package httplog
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// otherLabel is the label value for the values out of the allow-list or the limit.
+const otherLabel = "other"
+
+// MetricsOption defines the option of MetricsStore.
+type MetricsOption struct {
+	// Namespace is the prefix of the metric names, default httplog.
+	Namespace string
+	// LatencyBuckets are the upper bounds in seconds of the latency histogram buckets.
+	LatencyBuckets []float64
+	// SizeBuckets are the upper bounds in bytes of the request/response size histogram buckets.
+	SizeBuckets []float64
+	// Bizs is the allow-list of the biz label values, the others are labelled as other.
+	Bizs []string
+	// Routes is the allow-list of the route label values, the others are labelled as other.
+	Routes []string
+	// MaxLabelValues limits the distinct values of the biz and route labels without allow-lists, default 100.
+	MaxLabelValues int
+}
+
+// MetricsOptionFn defines the function prototype to setting MetricsOption.
+type MetricsOptionFn func(o *MetricsOption)
+
+// MetricsNamespace set the prefix of the metric names.
+func MetricsNamespace(namespace string) MetricsOptionFn {
+	return func(o *MetricsOption) { o.Namespace = namespace }
+}
+
+// MetricsLatencyBuckets set the upper bounds in seconds of the latency histogram buckets.
+func MetricsLatencyBuckets(buckets ...float64) MetricsOptionFn {
+	return func(o *MetricsOption) { o.LatencyBuckets = buckets }
+}
+
+// MetricsSizeBuckets set the upper bounds in bytes of the size histogram buckets.
+func MetricsSizeBuckets(buckets ...float64) MetricsOptionFn {
+	return func(o *MetricsOption) { o.SizeBuckets = buckets }
+}
+
+// MetricsBizs set the allow-list of the biz label values.
+func MetricsBizs(bizs ...string) MetricsOptionFn { return func(o *MetricsOption) { o.Bizs = bizs } }
+
+// MetricsRoutes set the allow-list of the route label values.
+func MetricsRoutes(routes ...string) MetricsOptionFn {
+	return func(o *MetricsOption) { o.Routes = routes }
+}
+
+// MetricsMaxLabelValues set the limit of the distinct values of the biz and route labels without allow-lists.
+func MetricsMaxLabelValues(n int) MetricsOptionFn {
+	return func(o *MetricsOption) { o.MaxLabelValues = n }
+}
+
+// MetricsStore updates the RED metrics from the logs, labelled by biz, method, route and status class,
+// and exposes them in the Prometheus text exposition format as an http.Handler.
+type MetricsStore struct {
+	option *MetricsOption
+	bizs   *labelValues
+	routes *labelValues
+
+	mu     sync.Mutex
+	series map[[4]string]*metricsSeries
+}
+
+type metricsSeries struct {
+	count    uint64
+	latency  *histogram
+	reqSize  *histogram
+	respSize *histogram
+}
+
+// NewMetricsStore creates a new MetricsStore.
+func NewMetricsStore(fns ...MetricsOptionFn) *MetricsStore {
+	option := &MetricsOption{
+		Namespace:      "httplog",
+		LatencyBuckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		SizeBuckets:    []float64{100, 1000, 10000, 100000, 1e6, 1e7},
+		MaxLabelValues: 100,
+	}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	return &MetricsStore{
+		option: option,
+		bizs:   newLabelValues(option.Bizs, option.MaxLabelValues),
+		routes: newLabelValues(option.Routes, option.MaxLabelValues),
+		series: make(map[[4]string]*metricsSeries),
+	}
+}
+
+// Store updates the metrics by the log.
+func (s *MetricsStore) Store(l *Log) {
+	labels := [4]string{s.bizs.value(l.Biz), metricsMethod(l.Method), s.routes.value(l.Route), statusClass(l.RspStatus)}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.series[labels]
+	if m == nil {
+		m = &metricsSeries{
+			latency:  newHistogram(s.option.LatencyBuckets),
+			reqSize:  newHistogram(s.option.SizeBuckets),
+			respSize: newHistogram(s.option.SizeBuckets),
+		}
+		s.series[labels] = m
+	}
+
+	m.count++
+	m.latency.observe(l.Duration.Seconds())
+	m.reqSize.observe(float64(l.ReqSize))
+	m.respSize.observe(float64(l.RespSize))
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (s *MetricsStore) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(s.Expose())
+}
+
+// Expose returns the metrics in the Prometheus text exposition format.
+func (s *MetricsStore) Expose() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([][4]string, 0, len(s.series))
+	for k := range s.series {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.Join(keys[i][:], "\x00") < strings.Join(keys[j][:], "\x00")
+	})
+
+	var b bytes.Buffer
+
+	ns := s.option.Namespace
+
+	b.WriteString("# HELP " + ns + "_requests_total Total number of HTTP requests.\n")
+	b.WriteString("# TYPE " + ns + "_requests_total counter\n")
+
+	for _, k := range keys {
+		b.WriteString(ns + "_requests_total{" + metricsLabels(k) + "} " +
+			strconv.FormatUint(s.series[k].count, 10) + "\n")
+	}
+
+	histograms := []struct {
+		name, help string
+		get        func(m *metricsSeries) *histogram
+	}{
+		{"request_duration_seconds", "HTTP request latencies in seconds.", func(m *metricsSeries) *histogram { return m.latency }},
+		{"request_size_bytes", "HTTP request body sizes in bytes.", func(m *metricsSeries) *histogram { return m.reqSize }},
+		{"response_size_bytes", "HTTP response body sizes in bytes.", func(m *metricsSeries) *histogram { return m.respSize }},
+	}
+
+	for _, h := range histograms {
+		name := ns + "_" + h.name
+		b.WriteString("# HELP " + name + " " + h.help + "\n")
+		b.WriteString("# TYPE " + name + " histogram\n")
+
+		for _, k := range keys {
+			h.get(s.series[k]).write(&b, name, metricsLabels(k))
+		}
+	}
+
+	return b.Bytes()
+}
+
+// labelValues bounds the values of a label by an allow-list, or by the max number of distinct values.
+type labelValues struct {
+	allowed map[string]bool
+	max     int
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newLabelValues(allowList []string, max int) *labelValues {
+	v := &labelValues{max: max, seen: make(map[string]bool)}
+
+	if len(allowList) > 0 {
+		v.allowed = make(map[string]bool, len(allowList))
+		for _, a := range allowList {
+			v.allowed[a] = true
+		}
+	}
+
+	return v
+}
+
+func (v *labelValues) value(s string) string {
+	if v.allowed != nil {
+		if v.allowed[s] {
+			return s
+		}
+
+		return otherLabel
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.seen[s] {
+		return s
+	}
+
+	if v.max > 0 && len(v.seen) >= v.max {
+		return otherLabel
+	}
+
+	v.seen[s] = true
+
+	return s
+}
+
+func metricsMethod(method string) string {
+	for _, m := range allHTTPMethods {
+		if m == method {
+			return m
+		}
+	}
+
+	return otherLabel
+}
+
+// statusClass returns the class of the status code, like 2xx.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return otherLabel
+	}
+
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func metricsLabels(k [4]string) string {
+	names := [4]string{"biz", "method", "route", "status"}
+	parts := make([]string, len(k))
+
+	for i, v := range k {
+		parts[i] = names[i] + `="` + escapeLabel(v) + `"`
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// nolint:gochecknoglobals
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string { return labelEscaper.Replace(v) }
+
+// histogram counts the observations in buckets.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// newHistogram creates a histogram by the bounds sorted ascending, without the duplicates, NaN and +Inf,
+// which is the last bucket always.
+func newHistogram(bounds []float64) *histogram {
+	sorted := make([]float64, 0, len(bounds))
+
+	for _, bound := range bounds {
+		if !math.IsNaN(bound) && !math.IsInf(bound, 1) {
+			sorted = append(sorted, bound)
+		}
+	}
+
+	sort.Float64s(sorted)
+
+	unique := sorted[:0]
+
+	for _, bound := range sorted {
+		if len(unique) == 0 || bound != unique[len(unique)-1] {
+			unique = append(unique, bound)
+		}
+	}
+
+	return &histogram{bounds: unique, counts: make([]uint64, len(unique))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(b *bytes.Buffer, name, labels string) {
+	var cumulative uint64
+
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		b.WriteString(name + "_bucket{" + labels + `,le="` + strconv.FormatFloat(bound, 'g', -1, 64) + `"} ` +
+			strconv.FormatUint(cumulative, 10) + "\n")
+	}
+
+	b.WriteString(name + "_bucket{" + labels + `,le="+Inf"} ` + strconv.FormatUint(h.count, 10) + "\n")
+	b.WriteString(name + "_sum{" + labels + "} " + strconv.FormatFloat(h.sum, 'g', -1, 64) + "\n")
+	b.WriteString(name + "_count{" + labels + "} " + strconv.FormatUint(h.count, 10) + "\n")
+}
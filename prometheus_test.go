@@ -0,0 +1,68 @@
+package httplog_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsStore(t *testing.T) {
+	store := httplog.NewMetricsStore(httplog.MetricsLatencyBuckets(0.1, 1), httplog.MetricsSizeBuckets(100),
+		httplog.MetricsRoutes("/hello/:name"))
+
+	store.Store(&httplog.Log{Biz: "hello", Method: "GET", Route: "/hello/:name", RspStatus: 200,
+		Duration: 50 * time.Millisecond, RespSize: 12})
+	store.Store(&httplog.Log{Biz: "hello", Method: "GET", Route: "/hello/:name", RspStatus: 204,
+		Duration: 500 * time.Millisecond, ReqSize: 1000})
+	store.Store(&httplog.Log{Biz: "x", Method: "BREW", Route: "/unknown/:id", RspStatus: 418})
+
+	w := httptest.NewRecorder()
+	store.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	lines := []string{
+		`# TYPE httplog_requests_total counter`,
+		`httplog_requests_total{biz="hello",method="GET",route="/hello/:name",status="2xx"} 2`,
+		`httplog_requests_total{biz="x",method="other",route="other",status="4xx"} 1`,
+		`# TYPE httplog_request_duration_seconds histogram`,
+		`httplog_request_duration_seconds_bucket{biz="hello",method="GET",route="/hello/:name",status="2xx",le="0.1"} 1`,
+		`httplog_request_duration_seconds_bucket{biz="hello",method="GET",route="/hello/:name",status="2xx",le="1"} 2`,
+		`httplog_request_duration_seconds_bucket{biz="hello",method="GET",route="/hello/:name",status="2xx",le="+Inf"} 2`,
+		`httplog_request_duration_seconds_sum{biz="hello",method="GET",route="/hello/:name",status="2xx"} 0.55`,
+		`httplog_request_size_bytes_bucket{biz="hello",method="GET",route="/hello/:name",status="2xx",le="100"} 1`,
+		`httplog_request_size_bytes_sum{biz="hello",method="GET",route="/hello/:name",status="2xx"} 1000`,
+		`httplog_response_size_bytes_count{biz="x",method="other",route="other",status="4xx"} 1`,
+	}
+
+	for _, line := range lines {
+		assert.True(t, strings.Contains(body, line+"\n"), line)
+	}
+
+	// the biz values beyond the limit are labelled as other.
+	limited := httplog.NewMetricsStore(httplog.MetricsMaxLabelValues(1))
+	limited.Store(&httplog.Log{Biz: "a", Method: "GET", RspStatus: 200})
+	limited.Store(&httplog.Log{Biz: "b", Method: "GET", RspStatus: 200})
+	assert.Contains(t, string(limited.Expose()), `httplog_requests_total{biz="other",method="GET",route="",status="2xx"} 1`)
+}
+
+func TestMetricsStoreUnsortedBuckets(t *testing.T) {
+	store := httplog.NewMetricsStore(httplog.MetricsLatencyBuckets(1, 0.1, 1, 0.5))
+	store.Store(&httplog.Log{Biz: "a", Method: "GET", RspStatus: 200, Duration: 50 * time.Millisecond})
+	store.Store(&httplog.Log{Biz: "a", Method: "GET", RspStatus: 200, Duration: 300 * time.Millisecond})
+
+	body := string(store.Expose())
+	prefix := `httplog_request_duration_seconds_bucket{biz="a",method="GET",route="",status="2xx",le=`
+
+	for _, line := range []string{prefix + `"0.1"} 1`, prefix + `"0.5"} 2`, prefix + `"1"} 2`} {
+		assert.Contains(t, body, line+"\n")
+	}
+
+	assert.Equal(t, 1, strings.Count(body, prefix+`"1"}`))
+}
@@ -0,0 +1,129 @@
+package httplog
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// LogRecord is the stable JSON representation of a Log, without the live *http.Request.
+type LogRecord struct {
+	ID           string            `json:"id"`
+	Biz          string            `json:"biz"`
+	TraceID      string            `json:"traceId,omitempty"`
+	SpanID       string            `json:"spanId,omitempty"`
+	ParentSpanID string            `json:"parentSpanId,omitempty"`
+	Tables       []string          `json:"tables,omitempty"`
+	Method       string            `json:"method"`
+	Host         string            `json:"host,omitempty"`
+	URL          string            `json:"url"`
+	Route        string            `json:"route,omitempty"`
+	IPAddr       string            `json:"ipAddr,omitempty"`
+	PathParams   map[string]string `json:"pathParams,omitempty"`
+	ReqHeader    http.Header       `json:"reqHeader,omitempty"`
+	ReqBody      string            `json:"reqBody,omitempty"`
+	ReqSize      int64             `json:"reqSize"`
+	RspStatus    int               `json:"rspStatus"`
+	RspHeader    http.Header       `json:"rspHeader,omitempty"`
+	RespSize     int64             `json:"respSize"`
+	RspBody      string            `json:"rspBody,omitempty"`
+	Created      time.Time         `json:"created"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	// Duration is in nanoseconds.
+	Duration time.Duration `json:"duration"`
+	Attrs    Attrs         `json:"attrs,omitempty"`
+	// SampleRate is the sample rate of the log kept by SamplingStore.
+	SampleRate float64    `json:"sampleRate,omitempty"`
+	Ws         *WsSession `json:"ws,omitempty"`
+}
+
+// Record returns the LogRecord of the log.
+func (l *Log) Record() *LogRecord {
+	r := &LogRecord{
+		ID:           l.ID,
+		Biz:          l.Biz,
+		TraceID:      l.TraceID,
+		SpanID:       l.SpanID,
+		ParentSpanID: l.ParentSpanID,
+		Method:       l.Method,
+		URL:          l.URL,
+		Route:        l.Route,
+		IPAddr:       l.IPAddr,
+		ReqHeader:    l.ReqHeader,
+		ReqBody:      l.ReqBody,
+		ReqSize:      l.ReqSize,
+		RspStatus:    l.RspStatus,
+		RspHeader:    l.RspHeader,
+		RespSize:     l.RespSize,
+		RspBody:      l.RspBody,
+		Created:      l.Created,
+		Start:        l.Start,
+		End:          l.End,
+		Duration:     l.Duration,
+		Attrs:        l.Attrs,
+		SampleRate:   l.SampleRate,
+		Ws:           l.Ws,
+	}
+
+	if l.Option != nil {
+		r.Tables = l.Option.Tables
+	}
+
+	if l.Request != nil {
+		r.Host = l.Request.Host
+	}
+
+	if len(l.PathParams) > 0 {
+		r.PathParams = make(map[string]string, len(l.PathParams))
+		for _, p := range l.PathParams {
+			r.PathParams[p.Key] = p.Value
+		}
+	}
+
+	return r
+}
+
+// Log rebuilds the Log from the record, with a Request made of the method, URL, headers and body.
+func (r *LogRecord) Log() *Log {
+	l := &Log{
+		ID:           r.ID,
+		Biz:          r.Biz,
+		TraceID:      r.TraceID,
+		SpanID:       r.SpanID,
+		ParentSpanID: r.ParentSpanID,
+		Method:       r.Method,
+		URL:          r.URL,
+		Route:        r.Route,
+		IPAddr:       r.IPAddr,
+		ReqHeader:    r.ReqHeader,
+		ReqBody:      r.ReqBody,
+		ReqSize:      r.ReqSize,
+		RspStatus:    r.RspStatus,
+		RspHeader:    r.RspHeader,
+		RespSize:     r.RespSize,
+		RspBody:      r.RspBody,
+		Created:      r.Created,
+		Start:        r.Start,
+		End:          r.End,
+		Duration:     r.Duration,
+		Attrs:        r.Attrs,
+		SampleRate:   r.SampleRate,
+		Ws:           r.Ws,
+		Option:       &Option{Biz: r.Biz, Tables: r.Tables},
+	}
+
+	for k, v := range r.PathParams {
+		l.PathParams = append(l.PathParams, httprouter.Param{Key: k, Value: v})
+	}
+
+	if req, err := http.NewRequest(r.Method, r.URL, strings.NewReader(r.ReqBody)); err == nil {
+		req.Header = r.ReqHeader
+		req.Host = r.Host
+		l.Request = req
+	}
+
+	return l
+}
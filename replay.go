@@ -0,0 +1,535 @@
+package httplog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// LoadJSONL loads the logs from the JSON Lines of LogRecord, like the files of FileStore and the dead letter file.
+// The logs with the truncated or binary request bodies are reported as errors by Replay.
+func LoadJSONL(r io.Reader) ([]*Log, error) {
+	var logs []*Log
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var record LogRecord
+		if err := JSONUnmarshal([]byte(line), &record); err != nil {
+			return logs, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		l := record.Log()
+		if binary, truncated := bodyState(l.ReqBody, l.ReqSize); binary || truncated {
+			l.truncated = append(l.truncated, "req_body")
+		}
+
+		logs = append(logs, l)
+	}
+
+	return logs, scanner.Err()
+}
+
+// LoadJSONLFile loads the logs from the JSON Lines file, gzip-compressed when it ends with .gz.
+func LoadJSONLFile(name string) ([]*Log, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var r io.Reader = f
+
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+
+		defer gz.Close()
+
+		r = gz
+	}
+
+	return LoadJSONL(r)
+}
+
+// LoadSQL loads the logs created since the time from the log table, ordered by the time column,
+// the log values are restored by the column tags like req_method, req_url, req_body, req_head_xxx, rsp_status and cost.
+// The logs with the request values filling their columns may be truncated, and are reported as errors by Replay.
+func LoadSQL(ctx context.Context, store *SQLStore, table string, since time.Time, limit int) ([]*Log, error) {
+	schema, err := store.loadTableSchema(table)
+	if err != nil {
+		return nil, err
+	}
+
+	column := timeColumn(schema.Cols)
+	if column == "" {
+		return nil, fmt.Errorf("no created or started column found in table %s", table)
+	}
+
+	d := store.Dialect
+	query := `select * from ` + quoteQualified(d, table) + ` where ` + d.Quote(column) + ` >= ` + d.Placeholder(0) +
+		` order by ` + d.Quote(column)
+
+	if limit > 0 {
+		query += ` limit ` + strconv.Itoa(limit)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := NewSQLRun(store.DB, NewMapPreparer("")).DoQuery(query, since)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	rows := result.StringRows()
+	logs := make([]*Log, len(rows))
+
+	for i, row := range rows {
+		logs[i] = logFromRow(schema.Cols, result.Headers, row)
+	}
+
+	return logs, nil
+}
+
+// logFromRow restores the log from the row by the column tags.
+func logFromRow(cols []TableCol, headers, row []string) *Log {
+	l := &Log{ReqHeader: make(http.Header)}
+
+	for _, c := range cols {
+		i := indexOf(headers, c.Name)
+		if i < 0 || row[i] == "" {
+			continue
+		}
+
+		v := row[i]
+
+		if replayedTag(c.Tag) && truncatedValue(v, c.MaxLength) {
+			l.truncated = append(l.truncated, c.Tag)
+		}
+
+		switch tag := c.Tag; {
+		case tag == "id":
+			l.ID = v
+		case tag == "biz":
+			l.Biz = v
+		case tag == "req_method":
+			l.Method = v
+		case tag == "req_url":
+			l.URL = v
+		case tag == "req_body":
+			l.ReqBody = v
+		case strings.HasPrefix(tag, "req_head_"):
+			l.ReqHeader.Set(tag[9:], v)
+		case tag == "rsp_status":
+			l.RspStatus, _ = strconv.Atoi(v)
+		case tag == "cost":
+			ms, _ := strconv.ParseInt(v, 10, 64)
+			l.Duration = time.Duration(ms) * time.Millisecond
+		case tag == "created":
+			l.Created = parseRowTime(v)
+		case tag == "started":
+			l.Start = parseRowTime(v)
+		}
+	}
+
+	if l.Method == "" {
+		l.Method = http.MethodGet
+	}
+
+	return l
+}
+
+// replayedTag tells whether the value of the tag is sent by the replay.
+func replayedTag(tag string) bool {
+	return tag == "req_url" || tag == "req_body" || strings.HasPrefix(tag, "req_head_")
+}
+
+// truncatedValue tells whether the value fills the column of the max length,
+// which is the case of the values abbreviated by the max length when stored, or cut by the database.
+func truncatedValue(v string, maxLength int) bool {
+	return maxLength > 0 && utf8.RuneCountInString(v) >= maxLength
+}
+
+func parseRowTime(v string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02 15:04:05.999999999-07:00"} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// ReplayOption defines the option of Replayer.
+type ReplayOption struct {
+	// Rate is the max number of requests per second, 0 for unlimited.
+	Rate float64
+	// Concurrency is the number of concurrent requests, default 1.
+	Concurrency int
+	// Header overrides the recorded request headers, the keys with empty values are removed.
+	Header http.Header
+	// TimeScale replays by the recorded intervals between the requests divided by the scale,
+	// like 1 for the original speed and 2 for the double speed, 0 to disable.
+	TimeScale float64
+	// Timeout is the timeout of a request, default 30s.
+	Timeout time.Duration
+	// OnResult, if not nil, is called with each result.
+	OnResult func(r ReplayResult)
+}
+
+// ReplayOptionFn defines the function prototype to setting ReplayOption.
+type ReplayOptionFn func(o *ReplayOption)
+
+// ReplayRate set the max number of requests per second.
+func ReplayRate(rate float64) ReplayOptionFn { return func(o *ReplayOption) { o.Rate = rate } }
+
+// ReplayConcurrency set the number of concurrent requests.
+func ReplayConcurrency(n int) ReplayOptionFn { return func(o *ReplayOption) { o.Concurrency = n } }
+
+// ReplayHeader set a header overriding the recorded one, the empty value removes it.
+func ReplayHeader(key, value string) ReplayOptionFn {
+	return func(o *ReplayOption) { o.Header[http.CanonicalHeaderKey(key)] = []string{value} }
+}
+
+// ReplayTimeScale set the scale of the recorded intervals between the requests.
+func ReplayTimeScale(scale float64) ReplayOptionFn {
+	return func(o *ReplayOption) { o.TimeScale = scale }
+}
+
+// ReplayTimeout set the timeout of a request.
+func ReplayTimeout(timeout time.Duration) ReplayOptionFn {
+	return func(o *ReplayOption) { o.Timeout = timeout }
+}
+
+// ReplayOnResult set the function called with each result.
+func ReplayOnResult(fn func(r ReplayResult)) ReplayOptionFn {
+	return func(o *ReplayOption) { o.OnResult = fn }
+}
+
+// ReplayResult is the result of a replayed request.
+type ReplayResult struct {
+	ID     string `json:"id"`
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// OrigStatus and OrigDuration are the recorded ones.
+	OrigStatus   int           `json:"origStatus"`
+	OrigDuration time.Duration `json:"origDuration"`
+	Status       int           `json:"status"`
+	Duration     time.Duration `json:"duration"`
+	Err          string        `json:"err,omitempty"`
+}
+
+// StatusChanged tells whether the status differs from the recorded one.
+func (r ReplayResult) StatusChanged() bool { return r.Err == "" && r.Status != r.OrigStatus }
+
+// ReplayLatency summarizes the latencies.
+type ReplayLatency struct {
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P95  time.Duration `json:"p95"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+// ReplayReport is the report of a replay.
+type ReplayReport struct {
+	Total  int `json:"total"`
+	Errors int `json:"errors"`
+	// StatusMatched is the number of the responses with the same status as the recorded one.
+	StatusMatched int `json:"statusMatched"`
+	// StatusDiffs counts the changed statuses, like {"200->500": 3}.
+	StatusDiffs map[string]int `json:"statusDiffs,omitempty"`
+	// OrigLatency and Latency summarize the recorded and the replayed latencies of the responded requests.
+	OrigLatency ReplayLatency  `json:"origLatency"`
+	Latency     ReplayLatency  `json:"latency"`
+	Results     []ReplayResult `json:"results"`
+}
+
+// String returns the summary of the report.
+func (r *ReplayReport) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "total %d, errors %d, status matched %d\n", r.Total, r.Errors, r.StatusMatched)
+
+	diffs := make([]string, 0, len(r.StatusDiffs))
+	for k := range r.StatusDiffs {
+		diffs = append(diffs, k)
+	}
+
+	sort.Strings(diffs)
+
+	for _, k := range diffs {
+		fmt.Fprintf(&b, "status %s: %d\n", k, r.StatusDiffs[k])
+	}
+
+	for _, l := range []struct {
+		name string
+		ReplayLatency
+	}{{"recorded", r.OrigLatency}, {"replayed", r.Latency}} {
+		fmt.Fprintf(&b, "%s latency mean %s, p50 %s, p95 %s, p99 %s, max %s\n", l.name, l.Mean, l.P50, l.P95, l.P99, l.Max)
+	}
+
+	return b.String()
+}
+
+// Replayer re-issues the recorded requests against a target, and compares the responses with the recorded ones.
+type Replayer struct {
+	target *url.URL
+	option *ReplayOption
+	client *http.Client
+}
+
+// NewReplayer creates a new Replayer sending to the target base URL, like http://127.0.0.1:8080.
+func NewReplayer(target string, fns ...ReplayOptionFn) (*Replayer, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid target %s, like http://127.0.0.1:8080", target)
+	}
+
+	option := &ReplayOption{Concurrency: 1, Header: make(http.Header), Timeout: 30 * time.Second}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	if option.Concurrency <= 0 {
+		option.Concurrency = 1
+	}
+
+	return &Replayer{target: u, option: option, client: &http.Client{
+		Timeout:       option.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}}, nil
+}
+
+// Replay replays the logs until all done or ctx is done, and returns the report of the replayed ones.
+func (p *Replayer) Replay(ctx context.Context, logs []*Log) *ReplayReport {
+	if p.option.TimeScale > 0 {
+		logs = append([]*Log(nil), logs...)
+		sort.SliceStable(logs, func(i, j int) bool { return replayTime(logs[i]).Before(replayTime(logs[j])) })
+	}
+
+	jobs := make(chan *Log)
+	results := make(chan ReplayResult)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < p.option.Concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for l := range jobs {
+				results <- p.replay(ctx, l)
+			}
+		}()
+	}
+
+	go func() {
+		p.dispatch(ctx, logs, jobs)
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	report := &ReplayReport{StatusDiffs: make(map[string]int)}
+
+	for r := range results {
+		if p.option.OnResult != nil {
+			p.option.OnResult(r)
+		}
+
+		report.Results = append(report.Results, r)
+	}
+
+	report.summarize()
+
+	return report
+}
+
+// dispatch sends the logs to the workers by the rate and the time scale.
+func (p *Replayer) dispatch(ctx context.Context, logs []*Log, jobs chan<- *Log) {
+	start := time.Now()
+	next := start
+
+	var interval time.Duration
+	if p.option.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / p.option.Rate)
+	}
+
+	for i, l := range logs {
+		at := next
+
+		if p.option.TimeScale > 0 && i > 0 {
+			offset := replayTime(l).Sub(replayTime(logs[0]))
+			if scaled := start.Add(time.Duration(float64(offset) / p.option.TimeScale)); scaled.After(at) {
+				at = scaled
+			}
+		}
+
+		if d := time.Until(at); d > 0 {
+			select {
+			case <-time.After(d):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case jobs <- l:
+		case <-ctx.Done():
+			return
+		}
+
+		next = at.Add(interval)
+	}
+}
+
+func replayTime(l *Log) time.Time {
+	if l.Start.IsZero() {
+		return l.Created
+	}
+
+	return l.Start
+}
+
+// replay sends the request of the log.
+func (p *Replayer) replay(ctx context.Context, l *Log) ReplayResult {
+	result := ReplayResult{ID: l.ID, Method: l.Method, URL: l.URL, OrigStatus: l.RspStatus, OrigDuration: l.Duration}
+
+	if len(l.truncated) > 0 {
+		result.Err = "not replayed, truncated or binary values: " + strings.Join(l.truncated, ", ")
+		return result
+	}
+
+	req, err := p.newRequest(ctx, l)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+
+	start := time.Now()
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Err = err.Error()
+
+		return result
+	}
+
+	_, _ = io.Copy(ioutil.Discard, rsp.Body)
+	_ = rsp.Body.Close()
+
+	result.Duration = time.Since(start)
+	result.Status = rsp.StatusCode
+
+	return result
+}
+
+func (p *Replayer) newRequest(ctx context.Context, l *Log) (*http.Request, error) {
+	ref, err := url.Parse(l.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	u := *p.target
+	u.Path = strings.TrimSuffix(u.Path, "/") + ref.Path
+	u.RawPath = ""
+	u.RawQuery = ref.RawQuery
+
+	req, err := http.NewRequest(l.Method, u.String(), strings.NewReader(l.ReqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range l.ReqHeader {
+		switch http.CanonicalHeaderKey(k) {
+		case "Content-Length", "Connection", "Transfer-Encoding", "Host":
+		default:
+			req.Header[k] = append([]string(nil), v...)
+		}
+	}
+
+	for k, v := range p.option.Header {
+		switch {
+		case len(v) == 0 || v[0] == "":
+			req.Header.Del(k)
+		case k == "Host":
+			req.Host = v[0]
+		default:
+			req.Header[k] = v
+		}
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+func (r *ReplayReport) summarize() {
+	var orig, replayed []time.Duration
+
+	for _, result := range r.Results {
+		r.Total++
+
+		if result.Err != "" {
+			r.Errors++
+			continue
+		}
+
+		orig = append(orig, result.OrigDuration)
+		replayed = append(replayed, result.Duration)
+
+		if result.StatusChanged() {
+			r.StatusDiffs[strconv.Itoa(result.OrigStatus)+"->"+strconv.Itoa(result.Status)]++
+		} else {
+			r.StatusMatched++
+		}
+	}
+
+	r.OrigLatency = summarizeLatency(orig)
+	r.Latency = summarizeLatency(replayed)
+}
+
+func summarizeLatency(ds []time.Duration) ReplayLatency {
+	if len(ds) == 0 {
+		return ReplayLatency{}
+	}
+
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+
+	var sum time.Duration
+	for _, d := range ds {
+		sum += d
+	}
+
+	at := func(p float64) time.Duration { return ds[int(p*float64(len(ds)-1))] }
+
+	return ReplayLatency{Mean: sum / time.Duration(len(ds)), P50: at(0.5), P95: at(0.95), P99: at(0.99), Max: ds[len(ds)-1]}
+}
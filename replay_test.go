@@ -0,0 +1,145 @@
+package httplog_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplay(t *testing.T) {
+	logs, err := httplog.LoadJSONL(strings.NewReader(`
+{"id":"1","method":"POST","url":"/orders?x=1","reqHeader":{"Authorization":["Bearer old"],"X-Keep":["1"]},"reqBody":"{\"n\":1}","rspStatus":201,"duration":5000000,"start":"2021-01-01T00:00:00Z"}
+{"id":"2","method":"GET","url":"/orders/2","rspStatus":200,"duration":1000000,"start":"2021-01-01T00:00:00.2Z"}
+`))
+	assert.Nil(t, err)
+	assert.Len(t, logs, 2)
+
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.String()+" "+r.Header.Get("Authorization")+" "+
+			r.Header.Get("X-Keep")+" "+string(body))
+		mu.Unlock()
+
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusInternalServerError)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	var results []httplog.ReplayResult
+
+	replayer, err := httplog.NewReplayer(server.URL+"/api", httplog.ReplayHeader("Authorization", "Bearer new"),
+		httplog.ReplayTimeScale(2), httplog.ReplayOnResult(func(r httplog.ReplayResult) { results = append(results, r) }))
+	assert.Nil(t, err)
+
+	start := time.Now()
+	report := replayer.Replay(context.Background(), logs)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	assert.Equal(t, []string{
+		`POST /api/orders?x=1 Bearer new 1 {"n":1}`,
+		`GET /api/orders/2 Bearer new  `,
+	}, requests)
+	assert.Len(t, results, 2)
+	assert.Equal(t, 2, report.Total)
+	assert.Equal(t, 1, report.StatusMatched)
+	assert.Equal(t, map[string]int{"200->500": 1}, report.StatusDiffs)
+	assert.Equal(t, 5*time.Millisecond, report.OrigLatency.Max)
+	assert.True(t, strings.Contains(report.String(), "status 200->500: 1\n"))
+
+	_, err = httplog.NewReplayer("127.0.0.1:8080")
+	assert.NotNil(t, err)
+}
+
+func TestReplayJSONLBody(t *testing.T) {
+	logs, err := httplog.LoadJSONL(strings.NewReader(`
+{"id":"1","method":"POST","url":"/a","reqBody":"{\"n\":1}","reqSize":7}
+{"id":"2","method":"POST","url":"/b","reqBody":"{\"n\":","reqSize":7}
+{"id":"3","method":"POST","url":"/c","reqBody":"\u0089PNG\u0000","reqSize":5}
+`))
+	assert.Nil(t, err)
+
+	var (
+		mu   sync.Mutex
+		urls []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		urls = append(urls, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	replayer, err := httplog.NewReplayer(server.URL)
+	assert.Nil(t, err)
+
+	report := replayer.Replay(context.Background(), logs)
+	assert.Equal(t, []string{"/a"}, urls)
+	assert.Equal(t, "", report.Results[0].Err)
+	assert.Equal(t, "not replayed, truncated or binary values: req_body", report.Results[1].Err)
+	assert.Equal(t, "not replayed, truncated or binary values: req_body", report.Results[2].Err)
+}
+
+func TestLoadSQL(t *testing.T) {
+	f := &fakeDB{query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if !strings.HasPrefix(query, "select *") {
+			return fakeColumns(
+				[]driver.Value{"id", "", "bigint", nil},
+				[]driver.Value{"created", "", "datetime", nil},
+				[]driver.Value{"method", `httplog:"req_method"`, "varchar", int64(10)},
+				[]driver.Value{"url", `httplog:"req_url"`, "varchar", int64(100)},
+				[]driver.Value{"ua", `httplog:"req_head_User-Agent"`, "varchar", int64(100)},
+				[]driver.Value{"status", `httplog:"rsp_status"`, "int", nil},
+				[]driver.Value{"cost", "", "int", nil},
+			)(query, args)
+		}
+
+		assert.Equal(t, "select * from `biz_log` where `created` >= ? order by `created` limit 10", query)
+
+		return []string{"id", "created", "method", "url", "ua", "status", "cost"}, [][]driver.Value{
+			{"1", "2021-01-01 10:00:00", "PUT", "/a?b=1", "curl", "204", "12"},
+			{"2", "2021-01-01 10:00:01", "GET", "/a?b=1", strings.Repeat("x", 97) + "...", "200", "1"},
+		}, nil
+	}}
+
+	logs, err := httplog.LoadSQL(context.Background(), httplog.NewSQLStore(openFakeDB(f)), "biz_log",
+		time.Now().Add(-time.Hour), 10)
+	assert.Nil(t, err)
+	assert.Len(t, logs, 2)
+
+	l := logs[0]
+	assert.Equal(t, "1", l.ID)
+	assert.Equal(t, "PUT", l.Method)
+	assert.Equal(t, "/a?b=1", l.URL)
+	assert.Equal(t, "curl", l.ReqHeader.Get("User-Agent"))
+	assert.Equal(t, 204, l.RspStatus)
+	assert.Equal(t, 12*time.Millisecond, l.Duration)
+	assert.Equal(t, time.Date(2021, 1, 1, 10, 0, 0, 0, time.Local), l.Created)
+
+	// the log with the truncated User-Agent is not replayed.
+	replayer, err := httplog.NewReplayer("http://127.0.0.1:1")
+	assert.Nil(t, err)
+
+	report := replayer.Replay(context.Background(), logs[1:])
+	assert.Equal(t, 1, report.Errors)
+	assert.Equal(t, "not replayed, truncated or binary values: req_head_User-Agent", report.Results[0].Err)
+}
@@ -0,0 +1,296 @@
+package httplog
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PurgeProgress reports the progress of purging a table.
+type PurgeProgress struct {
+	// Table is the table being purged, or the partition being dropped.
+	Table string
+	// Deleted is the number of rows deleted from the table so far.
+	Deleted int64
+	// Dropped tells the partition table is dropped.
+	Dropped bool
+	// Done tells the purging of the table is finished.
+	Done bool
+	// Err is the error stopping the purging of the table.
+	Err error
+}
+
+// PurgeOption defines the option of Purger.
+type PurgeOption struct {
+	// Retentions maps the tables, or the partitioned table name patterns like biz_log_${yyyyMM},
+	// to the number of days to keep their logs.
+	Retentions map[string]int
+	// BatchSize is the max number of rows deleted by one statement, default 1000.
+	BatchSize int
+	// Pause is the delay between the delete statements, so that the table is not locked for long, default 100ms.
+	Pause time.Duration
+	// Interval is the interval of the scheduled purging, default 1 hour.
+	Interval time.Duration
+	// Progress is called after each delete statement or partition dropping, default logs by logrus.
+	Progress func(PurgeProgress)
+}
+
+// PurgeOptionFn defines the function prototype to setting PurgeOption.
+type PurgeOptionFn func(o *PurgeOption)
+
+// PurgeRetention set the number of days to keep the logs of the table or the partitioned table name pattern.
+func PurgeRetention(table string, days int) PurgeOptionFn {
+	return func(o *PurgeOption) { o.Retentions[table] = days }
+}
+
+// PurgeBatchSize set the max number of rows deleted by one statement.
+func PurgeBatchSize(size int) PurgeOptionFn { return func(o *PurgeOption) { o.BatchSize = size } }
+
+// PurgePause set the delay between the delete statements.
+func PurgePause(pause time.Duration) PurgeOptionFn { return func(o *PurgeOption) { o.Pause = pause } }
+
+// PurgeInterval set the interval of the scheduled purging.
+func PurgeInterval(interval time.Duration) PurgeOptionFn {
+	return func(o *PurgeOption) { o.Interval = interval }
+}
+
+// PurgeProgressFn set the function to report the progress.
+func PurgeProgressFn(fn func(PurgeProgress)) PurgeOptionFn {
+	return func(o *PurgeOption) { o.Progress = fn }
+}
+
+// Purger removes the logs past the retention from the tables of a SQLStore.
+// For a table, the rows are deleted in small batches by the column tagged created or started,
+// for a partitioned table name pattern, the whole partitions past the retention are dropped.
+type Purger struct {
+	store  *SQLStore
+	option *PurgeOption
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPurger creates a new Purger for the tables of the store.
+func NewPurger(store *SQLStore, fns ...PurgeOptionFn) *Purger {
+	option := &PurgeOption{
+		Retentions: make(map[string]int),
+		BatchSize:  1000,
+		Pause:      100 * time.Millisecond,
+		Interval:   time.Hour,
+		Progress:   logPurgeProgress,
+	}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	if option.BatchSize <= 0 {
+		option.BatchSize = 1000
+	}
+
+	return &Purger{store: store, option: option}
+}
+
+func logPurgeProgress(p PurgeProgress) {
+	switch {
+	case p.Err != nil:
+		logrus.Warnf("purge %s error: %v", p.Table, p.Err)
+	case p.Dropped:
+		logrus.Infof("purge dropped partition %s", p.Table)
+	case p.Done:
+		logrus.Infof("purge %s done, %d rows deleted", p.Table, p.Deleted)
+	default:
+		logrus.Debugf("purge %s, %d rows deleted", p.Table, p.Deleted)
+	}
+}
+
+// Start starts purging periodically in background, the first purging starts immediately.
+func (p *Purger) Start() *Purger {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cancel != nil {
+		return p
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.done = make(chan struct{})
+
+	go p.loop(ctx, p.done)
+
+	return p
+}
+
+func (p *Purger) loop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(p.option.Interval)
+	defer ticker.Stop()
+
+	for {
+		_ = p.Purge(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops the scheduled purging, and waits for the current purging to stop.
+func (p *Purger) Close() {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.cancel = nil
+	p.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// Purge purges all the configured tables once, and returns the errors.
+func (p *Purger) Purge(ctx context.Context) error {
+	tables := make([]string, 0, len(p.option.Retentions))
+	for t := range p.option.Retentions {
+		tables = append(tables, t)
+	}
+
+	sort.Strings(tables)
+
+	var errs Errors
+
+	for _, t := range tables {
+		cutoff := time.Now().AddDate(0, 0, -p.option.Retentions[t])
+
+		var err error
+
+		if IsPartitioned(t) {
+			err = p.dropPartitions(ctx, t, cutoff)
+		} else {
+			err = p.PurgeTable(ctx, t, cutoff)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return errs.Err()
+}
+
+// PurgeTable deletes the rows created before the cutoff from the table in small batches.
+func (p *Purger) PurgeTable(ctx context.Context, table string, cutoff time.Time) error {
+	progress := PurgeProgress{Table: table}
+
+	err := p.purgeTable(ctx, table, cutoff, &progress)
+	progress.Done, progress.Err = true, err
+	p.option.Progress(progress)
+
+	return err
+}
+
+func (p *Purger) purgeTable(ctx context.Context, table string, cutoff time.Time, progress *PurgeProgress) error {
+	schema, err := p.store.loadTableSchema(table)
+	if err != nil {
+		return err
+	}
+
+	column := timeColumn(schema.Cols)
+	if column == "" {
+		return fmt.Errorf("no created or started column found in table %s", table)
+	}
+
+	query := p.store.Dialect.DeleteBefore(table, column, p.option.BatchSize)
+
+	for {
+		result := NewSQLExec(p.store.DB).DoUpdate(query, cutoff)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		progress.Deleted += result.RowsAffected
+
+		if result.RowsAffected < int64(p.option.BatchSize) {
+			return nil
+		}
+
+		p.option.Progress(*progress)
+
+		select {
+		case <-time.After(p.option.Pause):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// timeColumn returns the column tagged created, or started, or named so.
+func timeColumn(cols []TableCol) string {
+	for _, name := range []string{"created", "started"} {
+		for _, c := range cols {
+			if c.Tag == name {
+				return c.Name
+			}
+		}
+
+		for _, c := range cols {
+			if strings.EqualFold(c.Name, name) {
+				return c.Name
+			}
+		}
+	}
+
+	return ""
+}
+
+// dropPartitions drops the partitions of the partitioned table name pattern whose time range ends before the cutoff.
+func (p *Purger) dropPartitions(ctx context.Context, table string, cutoff time.Time) error {
+	tables, err := p.store.Dialect.ListTables(p.store.DB)
+	if err != nil {
+		p.option.Progress(PurgeProgress{Table: table, Done: true, Err: err})
+		return err
+	}
+
+	sort.Strings(tables)
+
+	template := p.store.templateOf(table)
+
+	for _, name := range tables {
+		if name == template {
+			continue
+		}
+
+		if _, end, ok := partitionRange(table, name); !ok || end.After(cutoff) {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		result := NewSQLExec(p.store.DB).DoUpdate(`drop table if exists ` + quoteQualified(p.store.Dialect, name))
+		p.option.Progress(PurgeProgress{Table: name, Dropped: result.Error == nil, Done: true, Err: result.Error})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		p.store.forgetTable(name)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package httplog_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurger(t *testing.T) {
+	thisMonth := "biz_log_" + time.Now().Format("200601")
+	remains := int64(5)
+
+	f := &fakeDB{
+		query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			if strings.Contains(query, "information_schema.tables") {
+				return []string{"table_name"}, [][]driver.Value{{"biz_log"}, {"biz_log_202001"}, {thisMonth}}, nil
+			}
+
+			return fakeColumns(
+				[]driver.Value{"id", "", "bigint", nil},
+				[]driver.Value{"created", `创建时间 httplog:"-"`, "datetime", nil},
+			)(query, args)
+		},
+		affected: func(query string, args []driver.Value) int64 {
+			if !strings.HasPrefix(query, "delete") {
+				return 0
+			}
+
+			n := remains
+			if n > 2 {
+				n = 2
+			}
+
+			remains -= n
+
+			return n
+		},
+	}
+
+	var progresses []httplog.PurgeProgress
+
+	store := httplog.NewSQLStore(openFakeDB(f))
+	purger := httplog.NewPurger(store,
+		httplog.PurgeRetention("http_log", 30), httplog.PurgeRetention("biz_log_${yyyyMM}", 90),
+		httplog.PurgeBatchSize(2), httplog.PurgePause(time.Millisecond),
+		httplog.PurgeProgressFn(func(p httplog.PurgeProgress) { progresses = append(progresses, p) }))
+
+	assert.Nil(t, purger.Purge(context.Background()))
+
+	execs := f.Execs()
+	assert.Equal(t, 4, len(execs))
+	assert.Equal(t, "drop table if exists `biz_log_202001`", execs[0].Query)
+	assert.Equal(t, "delete from `http_log` where `created` < ? limit 2", execs[1].Query)
+
+	cutoff := execs[1].Args[0].(time.Time)
+	assert.True(t, cutoff.Before(time.Now().AddDate(0, 0, -29)))
+
+	assert.Equal(t, []httplog.PurgeProgress{
+		{Table: "biz_log_202001", Dropped: true, Done: true},
+		{Table: "http_log", Deleted: 2},
+		{Table: "http_log", Deleted: 4},
+		{Table: "http_log", Deleted: 5, Done: true},
+	}, progresses)
+}
+
+func TestPurgerNoTimeColumn(t *testing.T) {
+	f := &fakeDB{query: fakeColumns([]driver.Value{"id", "", "bigint", nil})}
+	purger := httplog.NewPurger(httplog.NewSQLStore(openFakeDB(f)), httplog.PurgeRetention("http_log", 30),
+		httplog.PurgeProgressFn(func(httplog.PurgeProgress) {}))
+
+	assert.Equal(t, fmt.Errorf("no created or started column found in table http_log"),
+		purger.Purge(context.Background()))
+}
@@ -0,0 +1,223 @@
+package httplog
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RingQuery filters the logs in RingStore.
+type RingQuery struct {
+	// Biz is the biz to match exactly, empty for all.
+	Biz string
+	// Status is the response status like 404, or the status class like 5xx, empty for all.
+	Status string
+	// Path is the substring to match the URL, empty for all.
+	Path string
+	// Since and Until limit the creation time of the logs, zero for unlimited.
+	Since, Until time.Time
+	// Limit is the max number of logs to return, 0 for all.
+	Limit int
+}
+
+// Match tells whether the log record matches the query.
+func (q RingQuery) Match(r *LogRecord) bool {
+	if q.Biz != "" && r.Biz != q.Biz || q.Path != "" && !strings.Contains(r.URL, q.Path) {
+		return false
+	}
+
+	if q.Status != "" {
+		status := strconv.Itoa(r.RspStatus)
+		if len(q.Status) == 3 && strings.HasSuffix(q.Status, "xx") {
+			status = status[:1] + "xx"
+		}
+
+		if status != q.Status {
+			return false
+		}
+	}
+
+	return (q.Since.IsZero() || !r.Created.Before(q.Since)) && (q.Until.IsZero() || r.Created.Before(q.Until))
+}
+
+// ParseRingQuery parses the query from the URL query parameters biz, status, path, since, until and limit,
+// the since and until are in RFC 3339 or the durations before now, like 5m.
+func ParseRingQuery(values url.Values) RingQuery {
+	q := RingQuery{Biz: values.Get("biz"), Status: values.Get("status"), Path: values.Get("path"), Limit: 100}
+	q.Since = parseRingTime(values.Get("since"))
+	q.Until = parseRingTime(values.Get("until"))
+
+	if v, err := strconv.Atoi(values.Get("limit")); err == nil {
+		q.Limit = v
+	}
+
+	return q
+}
+
+func parseRingTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d)
+	}
+
+	t, _ := time.Parse(time.RFC3339, s)
+
+	return t
+}
+
+// RingStore keeps the last logs in memory, and browses them as an http.Handler,
+// e.g. http.Handle("/httplog/", http.StripPrefix("/httplog", ringStore)).
+type RingStore struct {
+	mu   sync.RWMutex
+	logs []*LogRecord
+	next int
+}
+
+// NewRingStore creates a new RingStore keeping the last size logs.
+func NewRingStore(size int) *RingStore {
+	if size <= 0 {
+		size = 1000
+	}
+
+	return &RingStore{logs: make([]*LogRecord, 0, size)}
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *RingStore) Store(log *Log) {
+	r := log.Record()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.logs) < cap(s.logs) {
+		s.logs = append(s.logs, r)
+		return
+	}
+
+	s.logs[s.next] = r
+	s.next = (s.next + 1) % len(s.logs)
+}
+
+// Logs returns the logs matching the query, the newest first.
+func (s *RingStore) Logs(q RingQuery) []*LogRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []*LogRecord
+
+	for i := 1; i <= len(s.logs); i++ {
+		r := s.logs[(s.next-i+len(s.logs))%len(s.logs)]
+		if !q.Match(r) {
+			continue
+		}
+
+		if result = append(result, r); q.Limit > 0 && len(result) >= q.Limit {
+			break
+		}
+	}
+
+	return result
+}
+
+// Get returns the log of the id, nil when it is not found.
+func (s *RingStore) Get(id string) *LogRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.logs {
+		if r.ID == id {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// ServeHTTP serves the logs browser, the list filtered by ParseRingQuery, or the log by the parameter id.
+// The JSON is served when the parameter format is json, or the request accepts application/json.
+func (s *RingStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	asJSON := values.Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json")
+
+	if id := values.Get("id"); id != "" {
+		record := s.Get(id)
+		if record == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		if asJSON {
+			_ = JSON{Data: record}.Render(w)
+			return
+		}
+
+		content, _ := JSONMarshalIndent(record, "", "  ")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = ringDetailTemplate.Execute(w, map[string]interface{}{"Log": record, "JSON": string(content)})
+
+		return
+	}
+
+	logs := s.Logs(ParseRingQuery(values))
+
+	if asJSON {
+		_ = JSON{Data: logs}.Render(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = ringListTemplate.Execute(w, map[string]interface{}{"Logs": logs, "Query": values})
+}
+
+const ringStyle = `<style>
+body{font-family:sans-serif;font-size:13px;margin:16px}
+table{border-collapse:collapse;width:100%}
+th,td{border-bottom:1px solid #ddd;padding:4px 8px;text-align:left;vertical-align:top}
+pre{background:#f6f8fa;padding:8px;overflow:auto}
+.s4{color:#b08800}.s5{color:#cb2431}
+</style>`
+
+// nolint:gochecknoglobals
+var (
+	ringFuncs = template.FuncMap{
+		"class": func(status int) string { return "s" + strconv.Itoa(status/100) },
+		"time":  func(t time.Time) string { return t.Format("15:04:05.000") },
+	}
+
+	ringListTemplate = template.Must(template.New("list").Funcs(ringFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>httplog</title>` + ringStyle + `</head><body>
+<form>
+biz <input name="biz" value="{{.Query.Get "biz"}}">
+status <input name="status" size="4" value="{{.Query.Get "status"}}">
+path <input name="path" value="{{.Query.Get "path"}}">
+since <input name="since" size="8" value="{{.Query.Get "since"}}" placeholder="5m">
+<button>filter</button> <a href="?format=json">JSON</a>
+</form>
+<table><tr><th>time</th><th>biz</th><th>method</th><th>url</th><th>status</th><th>cost</th><th>size</th></tr>
+{{range .Logs}}<tr><td><a href="?id={{.ID}}">{{time .Created}}</a></td><td>{{.Biz}}</td><td>{{.Method}}</td>
+<td>{{.URL}}</td><td class="{{class .RspStatus}}">{{.RspStatus}}</td><td>{{.Duration}}</td><td>{{.ReqSize}}/{{.RespSize}}</td></tr>
+{{end}}</table></body></html>`))
+
+	ringDetailTemplate = template.Must(template.New("detail").Funcs(ringFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>httplog {{.Log.ID}}</title>` + ringStyle + `</head><body>
+<p><a href="?">back</a> <a href="?id={{.Log.ID}}&format=json">JSON</a></p>
+<h3>{{.Log.Method}} {{.Log.URL}} <span class="{{class .Log.RspStatus}}">{{.Log.RspStatus}}</span></h3>
+<p>biz {{.Log.Biz}}, started {{.Log.Start}}, cost {{.Log.Duration}}</p>
+<h4>request headers</h4><pre>{{range $k, $v := .Log.ReqHeader}}{{$k}}: {{range $v}}{{.}} {{end}}
+{{end}}</pre>
+<h4>request body</h4><pre>{{.Log.ReqBody}}</pre>
+<h4>response headers</h4><pre>{{range $k, $v := .Log.RspHeader}}{{$k}}: {{range $v}}{{.}} {{end}}
+{{end}}</pre>
+<h4>response body</h4><pre>{{.Log.RspBody}}</pre>
+<h4>attrs</h4><pre>{{range $k, $v := .Log.Attrs}}{{$k}}: {{$v}}
+{{end}}</pre>
+<h4>record</h4><pre>{{.JSON}}</pre>
+</body></html>`))
+)
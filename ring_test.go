@@ -0,0 +1,65 @@
+package httplog_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingStore(t *testing.T) {
+	store := httplog.NewRingStore(3)
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		store.Store(&httplog.Log{ID: strconv.Itoa(i), Biz: "biz" + strconv.Itoa(i%2), URL: "/p/" + strconv.Itoa(i),
+			RspStatus: 200 + i*100%300, Created: now.Add(time.Duration(i) * time.Minute),
+			ReqHeader: http.Header{"X-Req": []string{"<1>"}}, RspBody: "body" + strconv.Itoa(i)})
+	}
+
+	ids := func(q httplog.RingQuery) (ids []string) {
+		for _, r := range store.Logs(q) {
+			ids = append(ids, r.ID)
+		}
+
+		return ids
+	}
+
+	assert.Equal(t, []string{"4", "3", "2"}, ids(httplog.RingQuery{}))
+	assert.Equal(t, []string{"4", "2"}, ids(httplog.RingQuery{Biz: "biz0"}))
+	assert.Equal(t, []string{"4"}, ids(httplog.RingQuery{Biz: "biz0", Limit: 1}))
+	assert.Equal(t, []string{"2"}, ids(httplog.RingQuery{Status: "4xx"}))
+	assert.Equal(t, []string{"3"}, ids(httplog.RingQuery{Status: "200"}))
+	assert.Equal(t, []string{"3"}, ids(httplog.RingQuery{Path: "/p/3"}))
+	assert.Equal(t, []string{"3", "2"}, ids(httplog.RingQuery{Until: now.Add(4 * time.Minute)}))
+	assert.Nil(t, store.Get("0"))
+
+	w := httptest.NewRecorder()
+	store.ServeHTTP(w, httptest.NewRequest("GET", "/?biz=biz1&format=json", nil))
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	var records []httplog.LogRecord
+
+	assert.Nil(t, httplog.JSONUnmarshal(w.Body.Bytes(), &records))
+	assert.Len(t, records, 1)
+	assert.Equal(t, "3", records[0].ID)
+
+	w = httptest.NewRecorder()
+	store.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.True(t, strings.Contains(w.Body.String(), `<a href="?id=4">`))
+
+	w = httptest.NewRecorder()
+	store.ServeHTTP(w, httptest.NewRequest("GET", "/?id=4", nil))
+	assert.True(t, strings.Contains(w.Body.String(), "X-Req: &lt;1&gt;"))
+	assert.True(t, strings.Contains(w.Body.String(), "body4"))
+
+	w = httptest.NewRecorder()
+	store.ServeHTTP(w, httptest.NewRequest("GET", "/?id=0", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
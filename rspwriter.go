@@ -0,0 +1,248 @@
+package httplog
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+)
+
+// responseWriter passes every write straight through to the wrapped http.ResponseWriter,
+// while recording the status code, the written size and at most maxBody bytes of the body.
+// Inspired by https://github.com/felixge/httpsnoop.
+type responseWriter struct {
+	http.ResponseWriter
+
+	code        int
+	wroteHeader bool
+	hijacked    bool
+	written     int64
+	maxBody     int
+	body        bytes.Buffer
+
+	// onHijack, if set, may wrap the hijacked connection.
+	onHijack func(net.Conn, *bufio.ReadWriter) (net.Conn, *bufio.ReadWriter)
+}
+
+func newResponseWriter(w http.ResponseWriter, maxBody int) *responseWriter {
+	return &responseWriter{ResponseWriter: w, code: http.StatusOK, maxBody: maxBody}
+}
+
+// WriteHeader sends an HTTP response header with the provided status code.
+func (w *responseWriter) WriteHeader(code int) {
+	// informational headers (except 101 Switching Protocols) may be followed by the final one.
+	if !w.wroteHeader && (code < 100 || code > 199 || code == http.StatusSwitchingProtocols) {
+		w.code = code
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes the data to the connection as part of an HTTP reply.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.capture(b[:n])
+
+	return n, err
+}
+
+// Flush sends any buffered data to the client.
+func (w *responseWriter) Flush() {
+	w.wroteHeader = true
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// Hijack lets the caller take over the connection.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		w.hijacked = true
+
+		if w.onHijack != nil {
+			conn, brw = w.onHijack(conn, brw)
+		}
+	}
+
+	return conn, brw, err
+}
+
+// Push initiates an HTTP/2 server push.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// ReadFrom reads data from src until EOF or error, and writes it to the client.
+// When the body capture is already full, the wrapped ReadFrom gets the src directly
+// so that optimizations like sendfile still take effect.
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.wroteHeader = true
+	rf := w.ResponseWriter.(io.ReaderFrom)
+
+	if w.body.Len() >= w.maxBody {
+		n, err := rf.ReadFrom(src)
+		w.written += n
+
+		return n, err
+	}
+
+	return rf.ReadFrom(&teeReader{Reader: src, w: w})
+}
+
+func (w *responseWriter) capture(b []byte) {
+	w.written += int64(len(b))
+
+	if room := w.maxBody - w.body.Len(); room > 0 {
+		if len(b) > room {
+			b = b[:room]
+		}
+
+		w.body.Write(b)
+	}
+}
+
+// respBody returns the captured body, abbreviated with ellipses when it was cut.
+func (w *responseWriter) respBody() string {
+	if w.written > int64(w.body.Len()) && w.maxBody >= 4 {
+		return string(w.body.Bytes()[:w.maxBody-3]) + "..."
+	}
+
+	return w.body.String()
+}
+
+type teeReader struct {
+	io.Reader
+	w *responseWriter
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.Reader.Read(p)
+	t.w.capture(p[:n])
+
+	return n, err
+}
+
+// wrap returns the responseWriter exposing only the optional interfaces
+// (http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom) which the underlying writer supports.
+// nolint:gomnd
+func (w *responseWriter) wrap() http.ResponseWriter {
+	_, f := w.ResponseWriter.(http.Flusher)
+	_, h := w.ResponseWriter.(http.Hijacker)
+	_, p := w.ResponseWriter.(http.Pusher)
+	_, r := w.ResponseWriter.(io.ReaderFrom)
+
+	type (
+		rw = http.ResponseWriter
+		fl = http.Flusher
+		hj = http.Hijacker
+		pu = http.Pusher
+		rf = io.ReaderFrom
+	)
+
+	switch b2i(f) | b2i(h)<<1 | b2i(p)<<2 | b2i(r)<<3 {
+	case 1:
+		return struct {
+			rw
+			fl
+		}{w, w}
+	case 2:
+		return struct {
+			rw
+			hj
+		}{w, w}
+	case 3:
+		return struct {
+			rw
+			fl
+			hj
+		}{w, w, w}
+	case 4:
+		return struct {
+			rw
+			pu
+		}{w, w}
+	case 5:
+		return struct {
+			rw
+			fl
+			pu
+		}{w, w, w}
+	case 6:
+		return struct {
+			rw
+			hj
+			pu
+		}{w, w, w}
+	case 7:
+		return struct {
+			rw
+			fl
+			hj
+			pu
+		}{w, w, w, w}
+	case 8:
+		return struct {
+			rw
+			rf
+		}{w, w}
+	case 9:
+		return struct {
+			rw
+			fl
+			rf
+		}{w, w, w}
+	case 10:
+		return struct {
+			rw
+			hj
+			rf
+		}{w, w, w}
+	case 11:
+		return struct {
+			rw
+			fl
+			hj
+			rf
+		}{w, w, w, w}
+	case 12:
+		return struct {
+			rw
+			pu
+			rf
+		}{w, w, w}
+	case 13:
+		return struct {
+			rw
+			fl
+			pu
+			rf
+		}{w, w, w, w}
+	case 14:
+		return struct {
+			rw
+			hj
+			pu
+			rf
+		}{w, w, w, w}
+	case 15:
+		return struct {
+			rw
+			fl
+			hj
+			pu
+			rf
+		}{w, w, w, w, w}
+	default:
+		return struct{ rw }{w}
+	}
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
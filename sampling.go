@@ -0,0 +1,146 @@
+package httplog
+
+import (
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SamplingOption defines the option of SamplingStore.
+type SamplingOption struct {
+	// Rate is the default sample rate in [0, 1], default 1 to keep all.
+	Rate float64
+	// BizRates are the sample rates by biz.
+	BizRates map[string]float64
+	// RouteRates are the sample rates by route, like /hello/:name, preferred to the biz rates.
+	RouteRates map[string]float64
+	// KeepErrors keeps the logs with RspStatus >= 500 always, default true.
+	KeepErrors bool
+	// SlowThreshold keeps the logs taking longer always, 0 to disable.
+	SlowThreshold time.Duration
+}
+
+// SamplingOptionFn defines the function prototype to setting SamplingOption.
+type SamplingOptionFn func(o *SamplingOption)
+
+// SampleRate set the default sample rate.
+func SampleRate(rate float64) SamplingOptionFn { return func(o *SamplingOption) { o.Rate = rate } }
+
+// SampleBizRate set the sample rate of the biz.
+func SampleBizRate(biz string, rate float64) SamplingOptionFn {
+	return func(o *SamplingOption) { o.BizRates[biz] = rate }
+}
+
+// SampleRouteRate set the sample rate of the route.
+func SampleRouteRate(route string, rate float64) SamplingOptionFn {
+	return func(o *SamplingOption) { o.RouteRates[route] = rate }
+}
+
+// SampleKeepErrors set whether to keep the logs with RspStatus >= 500 always.
+func SampleKeepErrors(keep bool) SamplingOptionFn {
+	return func(o *SamplingOption) { o.KeepErrors = keep }
+}
+
+// SampleSlowThreshold set the latency threshold above which the logs are kept always.
+func SampleSlowThreshold(threshold time.Duration) SamplingOptionFn {
+	return func(o *SamplingOption) { o.SlowThreshold = threshold }
+}
+
+// SamplingStore stores a sample of the logs to the underlying store.
+// The decision is deterministic by the trace ID, or the log ID without trace,
+// so the services in the same trace keep or drop it consistently.
+// The sample rate is recorded as Log.SampleRate of the kept logs, 1 for the ones kept always,
+// to re-weight the aggregates by 1/SampleRate.
+type SamplingStore struct {
+	store  StoreE
+	option *SamplingOption
+}
+
+// NewSamplingStore creates a new SamplingStore wrapping the store.
+func NewSamplingStore(store Store, fns ...SamplingOptionFn) *SamplingStore {
+	option := &SamplingOption{
+		Rate:       1,
+		BizRates:   make(map[string]float64),
+		RouteRates: make(map[string]float64),
+		KeepErrors: true,
+	}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	return &SamplingStore{store: AsStoreE(store), option: option}
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *SamplingStore) Store(log *Log) {
+	if err := s.StoreE(log); err != nil {
+		logrus.Warnf("failed to store log %s, error: %v", log.ID, err)
+	}
+}
+
+// StoreE stores the log when it is sampled, the log dropped by sampling is not an error.
+// The wrapped store gets a shallow copy with the SampleRate, the log shared with the other stores is not modified.
+func (s *SamplingStore) StoreE(log *Log) error {
+	rate, keep := s.Sample(log)
+	if !keep {
+		return nil
+	}
+
+	c := *log
+	c.SampleRate = rate
+
+	return s.store.StoreE(&c)
+}
+
+// Sample tells whether to keep the log, and the sample rate of it.
+func (s *SamplingStore) Sample(l *Log) (rate float64, keep bool) {
+	if s.option.KeepErrors && l.RspStatus >= 500 ||
+		s.option.SlowThreshold > 0 && l.Duration > s.option.SlowThreshold {
+		return 1, true
+	}
+
+	rate = s.rate(l)
+
+	switch {
+	case rate >= 1:
+		return 1, true
+	case rate <= 0:
+		return 0, false
+	}
+
+	key := l.TraceID
+	if key == "" {
+		key = l.ID
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+
+	return rate, float64(mix64(h.Sum64())) < rate*math.MaxUint64
+}
+
+// mix64 spreads the bits of the FNV hash of the similar keys like the sequential IDs, by the murmur3 finalizer.
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return h
+}
+
+func (s *SamplingStore) rate(l *Log) float64 {
+	if r, ok := s.option.RouteRates[l.Route]; ok && l.Route != "" {
+		return r
+	}
+
+	if r, ok := s.option.BizRates[l.Biz]; ok {
+		return r
+	}
+
+	return s.option.Rate
+}
@@ -0,0 +1,64 @@
+package httplog_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplingStore(t *testing.T) {
+	logs := make(chanStore, 10000)
+	store := httplog.NewSamplingStore(logs, httplog.SampleRate(0.1), httplog.SampleBizRate("health", 0),
+		httplog.SampleRouteRate("/orders/:id", 1), httplog.SampleSlowThreshold(time.Second))
+
+	for i := 0; i < 2000; i++ {
+		store.Store(&httplog.Log{ID: strconv.Itoa(i), RspStatus: 200})
+	}
+
+	assert.InDelta(t, 200, len(logs), 60)
+
+	for len(logs) > 0 {
+		assert.Equal(t, 0.1, (<-logs).SampleRate)
+	}
+
+	// the log shared with the other stores is not modified.
+	shared := &httplog.Log{ID: "1", RspStatus: 500}
+	store.Store(shared)
+	assert.Equal(t, 1.0, (<-logs).SampleRate)
+	assert.Equal(t, 0.0, shared.SampleRate)
+
+	// the decision is the same for the same trace.
+	l := &httplog.Log{ID: "1", TraceID: "4bf92f3577b34da6a3ce929d0e0e4736"}
+	rate, keep := store.Sample(l)
+
+	for i := 0; i < 10; i++ {
+		l.ID = strconv.Itoa(i)
+		r, k := store.Sample(l)
+		assert.Equal(t, keep, k)
+		assert.Equal(t, rate, r)
+	}
+
+	cases := []struct {
+		log  *httplog.Log
+		keep bool
+		rate float64
+	}{
+		{&httplog.Log{ID: "1", Biz: "health", RspStatus: 200}, false, 0},
+		{&httplog.Log{ID: "1", Biz: "health", RspStatus: 502}, true, 1},
+		{&httplog.Log{ID: "1", Biz: "health", Duration: 2 * time.Second}, true, 1},
+		{&httplog.Log{ID: "1", Biz: "health", Route: "/orders/:id"}, true, 1},
+	}
+
+	for _, c := range cases {
+		assert.Nil(t, store.StoreE(c.log))
+
+		if c.keep {
+			assert.Equal(t, c.rate, (<-logs).SampleRate)
+		} else {
+			assert.Len(t, logs, 0)
+		}
+	}
+}
@@ -36,6 +36,7 @@ var (
 	blts = make(map[matcher]col)
 	rsps = make(map[matcher]colV)
 	reqs = make(map[matcher]colV)
+	wss  = make(map[matcher]colV)
 )
 
 func getJSONBody(contentType, body string) string {
@@ -81,6 +82,11 @@ func init() {
 	blts[eq("cost")] = colFn(func(l *Log) interface{} { return l.Duration.Milliseconds() })
 	blts[eq("biz")] = colFn(func(l *Log) interface{} { return l.Biz })
 	blts[eq("addr")] = colFn(func(l *Log) interface{} { return l.IPAddr })
+	blts[eq("route")] = colFn(func(l *Log) interface{} { return l.Route })
+	blts[eq("trace_id")] = colFn(func(l *Log) interface{} { return l.TraceID })
+	blts[eq("span_id")] = colFn(func(l *Log) interface{} { return l.SpanID })
+	blts[eq("parent_span_id")] = colFn(func(l *Log) interface{} { return l.ParentSpanID })
+	blts[eq("sample_rate")] = colFn(func(l *Log) interface{} { return l.SampleRate })
 
 	rsps[starts("head_")] = colVFn(func(l *Log, v string) interface{} { return At(l.RspHeader[v[5:]], 0) })
 	rsps[eq("heads")] = colVFn(func(l *Log, v string) interface{} { return fmt.Sprintf("%+v", l.RspHeader) })
@@ -88,6 +94,7 @@ func init() {
 	rsps[eq("json")] = colVFn(func(l *Log, v string) interface{} { return getJSONBody(At(l.RspHeader["Content-Type"], 0), l.RspBody) })
 	rsps[starts("json_")] = colVFn(func(l *Log, v string) interface{} { return jsonpath(v[5:], l.RspBody) })
 	rsps[eq("status")] = colVFn(func(l *Log, v string) interface{} { return l.RspStatus })
+	rsps[eq("size")] = colVFn(func(l *Log, v string) interface{} { return l.RespSize })
 
 	reqs[starts("head_")] = colVFn(func(l *Log, v string) interface{} { return At(l.ReqHeader[v[5:]], 0) })
 	reqs[eq("heads")] = colVFn(func(l *Log, v string) interface{} { return fmt.Sprintf("%+v", l.ReqHeader) })
@@ -95,6 +102,7 @@ func init() {
 	reqs[eq("json")] = colVFn(func(l *Log, v string) interface{} { return getJSONBody(At(l.ReqHeader["Content-Type"], 0), l.ReqBody) })
 	reqs[starts("json_")] = colVFn(func(l *Log, v string) interface{} { return jsonpath(v[5:], l.ReqBody) })
 
+	reqs[eq("size")] = colVFn(func(l *Log, v string) interface{} { return l.ReqSize })
 	reqs[eq("method")] = colVFn(func(l *Log, v string) interface{} { return l.Method })
 	reqs[eq("url")] = colVFn(func(l *Log, v string) interface{} { return l.URL })
 	reqs[starts("path_")] = colVFn(func(l *Log, v string) interface{} { return l.pathVar(v[5:]) })
@@ -103,6 +111,35 @@ func init() {
 	reqs[eq("queries")] = colVFn(func(l *Log, v string) interface{} { return l.queryVars() })
 	reqs[starts("param_")] = colVFn(func(l *Log, v string) interface{} { return l.paramVar(v[6:]) })
 	reqs[eq("params")] = colVFn(func(l *Log, v string) interface{} { return l.paramVars() })
+	reqs[eq("curl")] = colVFn(func(l *Log, v string) interface{} { return l.Curl() })
+
+	wss[eq("close_code")] = wsColFn(func(s *WsSession) interface{} { return s.CloseCode })
+	wss[eq("in_frames")] = wsColFn(func(s *WsSession) interface{} { return s.InFrames })
+	wss[eq("in_bytes")] = wsColFn(func(s *WsSession) interface{} { return s.InBytes })
+	wss[eq("out_frames")] = wsColFn(func(s *WsSession) interface{} { return s.OutFrames })
+	wss[eq("out_bytes")] = wsColFn(func(s *WsSession) interface{} { return s.OutBytes })
+	wss[eq("messages")] = wsColFn(func(s *WsSession) interface{} { return wsMessagesJSON(s.Messages) })
+}
+
+// wsColFn creates a colV of the WebSocket session, which returns nil for the non-WebSocket requests.
+func wsColFn(f func(s *WsSession) interface{}) colV {
+	return colVFn(func(l *Log, v string) interface{} {
+		if l.Ws == nil {
+			return nil
+		}
+
+		return f(l.Ws)
+	})
+}
+
+func wsMessagesJSON(messages []WsMessage) interface{} {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	b, _ := JSONMarshal(messages)
+
+	return string(b)
 }
 
 func (s *TableCol) parseComment() {
@@ -114,11 +151,15 @@ func (s *TableCol) parseComment() {
 		}
 	}
 
+	s.Tag = tag
+
 	switch {
 	case strings.HasPrefix(tag, "req_"):
 		s.ValueGetter = createValueGetter(tag[4:], reqs)
 	case strings.HasPrefix(tag, "rsp_"):
 		s.ValueGetter = createValueGetter(tag[4:], rsps)
+	case strings.HasPrefix(tag, "ws_"):
+		s.ValueGetter = createValueGetter(tag[3:], wss)
 	case strings.HasPrefix(tag, "ctx_"):
 		s.ValueGetter = createCtxValueGetter(tag[4:])
 	case tag == "-":
@@ -0,0 +1,681 @@
+package httplog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FsyncPolicy defines when the spool segment is synced to the disk.
+type FsyncPolicy int
+
+const (
+	// FsyncInterval syncs the segment periodically, by SpoolOption.FsyncInterval.
+	FsyncInterval FsyncPolicy = iota
+	// FsyncAlways syncs the segment after each log.
+	FsyncAlways
+	// FsyncNever leaves the syncing to the operating system.
+	FsyncNever
+)
+
+const (
+	spoolSegmentExt  = ".seg"
+	spoolCheckpoint  = "checkpoint"
+	spoolCheckpointN = 100
+)
+
+// SpoolOption defines the option of SpoolStore.
+type SpoolOption struct {
+	// SegmentSize is the size to rotate the segment file, default 16MiB.
+	SegmentSize int64
+	// MaxBytes caps the total size of the spool, new logs are dropped when reached, default 1GiB.
+	MaxBytes int64
+	// Fsync is the policy to sync the segment, default FsyncInterval.
+	Fsync FsyncPolicy
+	// FsyncInterval is the interval of FsyncInterval policy, default 1s.
+	FsyncInterval time.Duration
+	// Backoff is the delay between the replay retries while the wrapped store keeps failing,
+	// its Retries is ignored because the replay retries until success.
+	Backoff Backoff
+}
+
+// SpoolOptionFn defines the function prototype to setting SpoolOption.
+type SpoolOptionFn func(o *SpoolOption)
+
+// SpoolSegmentSize set the size to rotate the segment file.
+func SpoolSegmentSize(size int64) SpoolOptionFn { return func(o *SpoolOption) { o.SegmentSize = size } }
+
+// SpoolMaxBytes set the size cap of the spool.
+func SpoolMaxBytes(size int64) SpoolOptionFn { return func(o *SpoolOption) { o.MaxBytes = size } }
+
+// SpoolFsync set the policy to sync the segment, and the interval for FsyncInterval.
+func SpoolFsync(policy FsyncPolicy, interval time.Duration) SpoolOptionFn {
+	return func(o *SpoolOption) {
+		o.Fsync = policy
+		o.FsyncInterval = interval
+	}
+}
+
+// SpoolBackoff set the delay between the replay retries while the wrapped store keeps failing.
+func SpoolBackoff(backoff Backoff) SpoolOptionFn { return func(o *SpoolOption) { o.Backoff = backoff } }
+
+// SpoolStats holds the metrics of SpoolStore.
+type SpoolStats struct {
+	// Pending is the number of logs in the spool waiting to be replayed.
+	Pending int64
+	// Bytes is the size of the spool.
+	Bytes int64
+	// Segments is the number of segment files.
+	Segments int
+	// Replayed is the number of logs forwarded to the wrapped store.
+	Replayed int64
+	// Dropped is the number of logs dropped for the size cap or write errors.
+	Dropped int64
+	// LastError is the last error of the wrapped store.
+	LastError string
+}
+
+// spoolPos is the position of the next log to be replayed.
+type spoolPos struct {
+	Segment int64 `json:"segment"`
+	Offset  int64 `json:"offset"`
+}
+
+// SpoolStore is a write-ahead store, which appends logs to the segment files in a local directory,
+// and forwards them to the wrapped store in background, retrying while the wrapped store is failing,
+// e.g. the database is down or being restarted.
+//
+// The replay position is checkpointed every 100 logs and at segment ends,
+// so after a crash a few logs may be forwarded again.
+type SpoolStore struct {
+	dir    string
+	store  StoreE
+	option *SpoolOption
+
+	mu       sync.Mutex
+	closed   bool
+	seg      *os.File
+	segSeq   int64
+	segSize  int64
+	dirty    bool
+	segments map[int64]int64 // segment sequence to its size
+	pending  int64
+	replayed int64
+	dropped  int64
+	lastErr  string
+
+	notify chan struct{}
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewSpoolStore creates a SpoolStore spooling in the dir and forwarding to the store.
+func NewSpoolStore(dir string, store Store, fns ...SpoolOptionFn) (*SpoolStore, error) {
+	option := &SpoolOption{
+		SegmentSize:   16 << 20,
+		MaxBytes:      1 << 30,
+		FsyncInterval: time.Second,
+		Backoff:       Backoff{Initial: 100 * time.Millisecond, Max: 30 * time.Second, Multiplier: 2},
+	}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &SpoolStore{
+		dir:      dir,
+		store:    AsStoreE(store),
+		option:   option,
+		segments: make(map[int64]int64),
+		notify:   make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+
+	pos, err := s.recover()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.openSegment(s.segSeq + 1); err != nil {
+		return nil, err
+	}
+
+	s.wg.Add(1)
+
+	go s.replay(pos)
+
+	if option.Fsync == FsyncInterval && option.FsyncInterval > 0 {
+		s.wg.Add(1)
+
+		go s.syncLoop()
+	}
+
+	return s, nil
+}
+
+// recover loads the checkpoint and the existing segments, removes the replayed segments,
+// and counts the pending logs.
+func (s *SpoolStore) recover() (spoolPos, error) {
+	var pos spoolPos
+
+	if b, err := ioutil.ReadFile(filepath.Join(s.dir, spoolCheckpoint)); err == nil {
+		if err := JSONUnmarshal(b, &pos); err != nil {
+			logrus.Warnf("bad spool checkpoint %s, error: %v", b, err)
+		}
+	}
+
+	seqs, err := s.listSegments()
+	if err != nil {
+		return pos, err
+	}
+
+	for _, seq := range seqs {
+		name := s.segmentPath(seq)
+
+		if seq < pos.Segment {
+			_ = os.Remove(name)
+			continue
+		}
+
+		fi, err := os.Stat(name)
+		if err != nil {
+			return pos, err
+		}
+
+		s.segments[seq] = fi.Size()
+		s.segSeq = seq
+
+		offset := int64(0)
+		if seq == pos.Segment {
+			offset = pos.Offset
+		}
+
+		s.pending += countLines(name, offset)
+	}
+
+	if _, ok := s.segments[pos.Segment]; !ok {
+		pos.Offset = 0
+	}
+
+	if s.segSeq < pos.Segment-1 {
+		s.segSeq = pos.Segment - 1
+	}
+
+	return pos, nil
+}
+
+func countLines(name string, offset int64) int64 {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0
+	}
+
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0
+	}
+
+	n := int64(0)
+	r := bufio.NewReader(f)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			n++
+		}
+
+		if err != nil {
+			return n
+		}
+	}
+}
+
+func (s *SpoolStore) listSegments() ([]int64, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var seqs []int64
+
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), spoolSegmentExt) {
+			continue
+		}
+
+		if seq, err := strconv.ParseInt(strings.TrimSuffix(f.Name(), spoolSegmentExt), 10, 64); err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	return seqs, nil
+}
+
+func (s *SpoolStore) segmentPath(seq int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// openSegment opens a new segment for appending, it is called with s.mu held or before serving.
+func (s *SpoolStore) openSegment(seq int64) error {
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.seg, s.segSeq, s.segSize = f, seq, 0
+	s.segments[seq] = 0
+
+	return nil
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *SpoolStore) Store(l *Log) {
+	if err := s.StoreE(l); err != nil {
+		logrus.Warnf("failed to spool log %s, error: %v", l.ID, err)
+	}
+}
+
+// StoreE appends the log to the spool.
+func (s *SpoolStore) StoreE(l *Log) error {
+	b, err := JSONMarshal(l.Record())
+	if err != nil {
+		return err
+	}
+
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		s.dropped++
+		return ErrDropped
+	}
+
+	if s.seg == nil {
+		// the segment is lost by the failed rotation, start the next one.
+		if err := s.openSegment(s.segSeq + 1); err != nil {
+			s.dropped++
+			return err
+		}
+	}
+
+	if s.option.MaxBytes > 0 && s.totalBytes()+int64(len(b)) > s.option.MaxBytes {
+		s.dropped++
+		return fmt.Errorf("spool is full: %w", ErrDropped)
+	}
+
+	if s.segSize > 0 && s.segSize+int64(len(b)) > s.option.SegmentSize {
+		if err := s.rotate(); err != nil {
+			if s.seg == nil {
+				s.dropped++
+				return err
+			}
+
+			logrus.Warnf("failed to rotate spool segment %d, error: %v", s.segSeq, err)
+		}
+	}
+
+	if _, err := s.seg.Write(b); err != nil {
+		s.dropped++
+		return err
+	}
+
+	s.segSize += int64(len(b))
+	s.segments[s.segSeq] = s.segSize
+	s.pending++
+	s.dirty = true
+
+	if s.option.Fsync == FsyncAlways {
+		if err := s.seg.Sync(); err != nil {
+			return err
+		}
+
+		s.dirty = false
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+func (s *SpoolStore) totalBytes() int64 {
+	total := int64(0)
+	for _, size := range s.segments {
+		total += size
+	}
+
+	return total
+}
+
+func (s *SpoolStore) rotate() error {
+	if s.option.Fsync != FsyncNever {
+		_ = s.seg.Sync()
+	}
+
+	err := s.seg.Close()
+	s.seg = nil
+
+	if err == nil {
+		err = s.openSegment(s.segSeq + 1)
+	}
+
+	if err != nil {
+		// keep appending to the current segment, or leave it to the next StoreE to open the next one.
+		if f, e := os.OpenFile(s.segmentPath(s.segSeq), os.O_APPEND|os.O_WRONLY, 0o644); e == nil {
+			s.seg = f
+		}
+	}
+
+	return err
+}
+
+func (s *SpoolStore) syncLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.option.FsyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.dirty && s.seg != nil {
+				_ = s.seg.Sync()
+				s.dirty = false
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Stats returns the metrics of the spool.
+func (s *SpoolStore) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return SpoolStats{
+		Pending:   s.pending,
+		Bytes:     s.totalBytes(),
+		Segments:  len(s.segments),
+		Replayed:  s.replayed,
+		Dropped:   s.dropped,
+		LastError: s.lastErr,
+	}
+}
+
+// Close stops the replaying, syncs and closes the current segment.
+// The logs not replayed yet stay in the spool for the next start.
+func (s *SpoolStore) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+
+	seg := s.seg
+	s.seg, s.closed = nil, true
+	s.mu.Unlock()
+
+	close(s.stop)
+
+	done := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if seg == nil {
+		return err
+	}
+
+	if e := seg.Sync(); e != nil && err == nil {
+		err = e
+	}
+
+	if e := seg.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// replay forwards the spooled logs to the wrapped store from pos.
+func (s *SpoolStore) replay(pos spoolPos) {
+	defer s.wg.Done()
+
+	unsaved := 0
+
+	// save the logs forwarded since the last checkpoint when stopped, not to replay them again on the next start.
+	defer func() {
+		if unsaved > 0 {
+			s.saveCheckpoint(pos)
+		}
+	}()
+
+	for {
+		s.mu.Lock()
+		activeSeq, activeSize := s.segSeq, s.segSize
+		s.mu.Unlock()
+
+		if pos.Segment < activeSeq {
+			// an older segment, replay all of it and then remove it.
+			if !s.replaySegment(&pos, -1, &unsaved) {
+				return
+			}
+
+			s.removeSegment(pos.Segment)
+			pos = spoolPos{Segment: s.nextSegment(pos.Segment)}
+			s.saveCheckpoint(pos)
+			unsaved = 0
+
+			continue
+		}
+
+		if pos.Segment == activeSeq && pos.Offset < activeSize {
+			if !s.replaySegment(&pos, activeSize, &unsaved) {
+				return
+			}
+
+			continue
+		}
+
+		if unsaved > 0 {
+			s.saveCheckpoint(pos)
+			unsaved = 0
+		}
+
+		select {
+		case <-s.notify:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// nextSegment returns the sequence of the segment after seq.
+func (s *SpoolStore) nextSegment(seq int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := s.segSeq
+
+	for k := range s.segments {
+		if k > seq && k < next {
+			next = k
+		}
+	}
+
+	return next
+}
+
+func (s *SpoolStore) removeSegment(seq int64) {
+	s.mu.Lock()
+	delete(s.segments, seq)
+	s.mu.Unlock()
+
+	if err := os.Remove(s.segmentPath(seq)); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("failed to remove spool segment %d, error: %v", seq, err)
+	}
+}
+
+// replaySegment replays the logs of the segment from pos up to limit bytes, or to its end if limit < 0.
+// It returns false when the store is stopping.
+func (s *SpoolStore) replaySegment(pos *spoolPos, limit int64, unsaved *int) bool {
+	f, err := os.Open(s.segmentPath(pos.Segment))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warnf("failed to open spool segment %d, error: %v", pos.Segment, err)
+		}
+
+		pos.Offset = limit
+
+		return true
+	}
+
+	defer f.Close()
+
+	if _, err := f.Seek(pos.Offset, io.SeekStart); err != nil {
+		logrus.Warnf("failed to seek spool segment %d, error: %v", pos.Segment, err)
+		return true
+	}
+
+	var r io.Reader = f
+	if limit >= 0 {
+		r = io.LimitReader(f, limit-pos.Offset)
+	}
+
+	br := bufio.NewReader(r)
+
+	for {
+		line, _ := br.ReadBytes('\n')
+		if len(line) == 0 || line[len(line)-1] != '\n' {
+			if len(line) > 0 && limit < 0 {
+				logrus.Warnf("drop the torn tail of spool segment %d: %s", pos.Segment, line)
+			}
+
+			return true
+		}
+
+		if !s.forward(line) {
+			return false
+		}
+
+		pos.Offset += int64(len(line))
+
+		if *unsaved++; *unsaved >= spoolCheckpointN {
+			s.saveCheckpoint(*pos)
+			*unsaved = 0
+		}
+	}
+}
+
+// forward stores the log line by the wrapped store, retrying until success.
+// It returns false when the store is stopping.
+func (s *SpoolStore) forward(line []byte) bool {
+	var r LogRecord
+
+	if err := JSONUnmarshal(line, &r); err != nil {
+		logrus.Warnf("drop the bad spool line %s, error: %v", line, err)
+		s.done("")
+
+		return true
+	}
+
+	l := r.Log()
+
+	delay := s.option.Backoff.Initial
+	if delay <= 0 {
+		delay = 10 * time.Millisecond
+	}
+
+	for {
+		err := s.store.StoreE(l)
+		if err == nil {
+			s.done("")
+			return true
+		}
+
+		s.mu.Lock()
+		s.lastErr = err.Error()
+		s.mu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-s.stop:
+			return false
+		}
+
+		delay = s.option.Backoff.next(delay)
+	}
+}
+
+func (s *SpoolStore) done(lastErr string) {
+	s.mu.Lock()
+	s.pending--
+	s.replayed++
+	s.lastErr = lastErr
+	s.mu.Unlock()
+}
+
+// saveCheckpoint writes the checkpoint crash-safely by writing a temporary file and renaming it.
+func (s *SpoolStore) saveCheckpoint(pos spoolPos) {
+	b, _ := JSONMarshal(pos)
+	name := filepath.Join(s.dir, spoolCheckpoint)
+	tmp := name + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		logrus.Warnf("failed to save spool checkpoint, error: %v", err)
+		return
+	}
+
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if e := f.Close(); err == nil {
+		err = e
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+
+	if err != nil {
+		logrus.Warnf("failed to save spool checkpoint, error: %v", err)
+	}
+}
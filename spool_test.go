@@ -0,0 +1,187 @@
+package httplog_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+// switchStore fails while it is down.
+type switchStore struct {
+	mu   sync.Mutex
+	down bool
+	ids  []string
+}
+
+func (s *switchStore) Store(l *httplog.Log) { _ = s.StoreE(l) }
+
+func (s *switchStore) StoreE(l *httplog.Log) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.down {
+		return errors.New("database is down")
+	}
+
+	s.ids = append(s.ids, l.ID)
+
+	return nil
+}
+
+func (s *switchStore) setDown(down bool) {
+	s.mu.Lock()
+	s.down = down
+	s.mu.Unlock()
+}
+
+func (s *switchStore) IDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.ids...)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	for i := 0; i < 200 && !cond(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.True(t, cond())
+}
+
+func TestSpoolStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	backoff := httplog.SpoolBackoff(httplog.Backoff{Initial: 5 * time.Millisecond, Max: 20 * time.Millisecond})
+	down := &switchStore{down: true}
+	s, err := httplog.NewSpoolStore(dir, down, httplog.SpoolSegmentSize(300), backoff)
+	assert.Nil(t, err)
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		assert.Nil(t, s.StoreE(&httplog.Log{ID: id, Option: &httplog.Option{}}))
+	}
+
+	stats := s.Stats()
+	assert.Equal(t, int64(4), stats.Pending)
+	assert.True(t, stats.Segments > 1)
+	waitFor(t, func() bool { return s.Stats().LastError == "database is down" })
+	assert.Nil(t, s.Close(context.Background()))
+
+	// restart with the database recovered.
+	up := &switchStore{}
+	s, err = httplog.NewSpoolStore(dir, up, httplog.SpoolSegmentSize(300), backoff)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), s.Stats().Pending)
+
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "5", Option: &httplog.Option{}}))
+	waitFor(t, func() bool { return s.Stats().Pending == 0 })
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, up.IDs())
+
+	up.setDown(true)
+	assert.Nil(t, s.Close(context.Background()))
+
+	stats = s.Stats()
+	assert.Equal(t, int64(5), stats.Replayed)
+	assert.Equal(t, 1, stats.Segments)
+}
+
+func TestSpoolStoreMaxBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	s, err := httplog.NewSpoolStore(dir, &switchStore{down: true}, httplog.SpoolMaxBytes(200))
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "1"}))
+	assert.True(t, errors.Is(s.StoreE(&httplog.Log{ID: "2"}), httplog.ErrDropped))
+	assert.Equal(t, int64(1), s.Stats().Dropped)
+	assert.Nil(t, s.Close(context.Background()))
+}
+
+// limitStore stores the first n logs, and fails after that.
+type limitStore struct {
+	switchStore
+	n int
+}
+
+func (s *limitStore) StoreE(l *httplog.Log) error {
+	if len(s.IDs()) >= s.n {
+		s.setDown(true)
+	}
+
+	return s.switchStore.StoreE(l)
+}
+
+func TestSpoolStoreCheckpointOnClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	backoff := httplog.SpoolBackoff(httplog.Backoff{Initial: 5 * time.Millisecond, Max: 20 * time.Millisecond})
+	limit := &limitStore{n: 3}
+	s, err := httplog.NewSpoolStore(dir, limit, backoff)
+	assert.Nil(t, err)
+
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		assert.Nil(t, s.StoreE(&httplog.Log{ID: id, Option: &httplog.Option{}}))
+	}
+
+	waitFor(t, func() bool { return s.Stats().LastError == "database is down" })
+	assert.Nil(t, s.Close(context.Background()))
+	assert.Equal(t, []string{"1", "2", "3"}, limit.IDs())
+
+	// the forwarded logs are not replayed again after the restart.
+	up := &switchStore{}
+	s, err = httplog.NewSpoolStore(dir, up, backoff)
+	assert.Nil(t, err)
+
+	waitFor(t, func() bool { return len(up.IDs()) >= 2 })
+	assert.Nil(t, s.Close(context.Background()))
+	assert.Equal(t, []string{"4", "5"}, up.IDs())
+}
+
+func TestSpoolStoreRotateFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	backoff := httplog.SpoolBackoff(httplog.Backoff{Initial: 5 * time.Millisecond, Max: 20 * time.Millisecond})
+	up := &switchStore{}
+	s, err := httplog.NewSpoolStore(dir, up, httplog.SpoolSegmentSize(300), backoff)
+	assert.Nil(t, err)
+
+	// the next segment fails to open when a directory is in its place, the current one is kept appending.
+	next := filepath.Join(dir, "00000000000000000002.seg")
+	assert.Nil(t, os.Mkdir(next, 0o755))
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "1", Option: &httplog.Option{}}))
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "2", Option: &httplog.Option{}}))
+	assert.Nil(t, os.Remove(next))
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "3", Option: &httplog.Option{}}))
+	waitFor(t, func() bool { return len(up.IDs()) == 3 })
+	assert.Equal(t, []string{"1", "2", "3"}, up.IDs())
+
+	// the current segment is lost with the directory, the next one is opened after the directory is back.
+	assert.Nil(t, os.RemoveAll(dir))
+	assert.NotNil(t, s.StoreE(&httplog.Log{ID: "4", Option: &httplog.Option{}}))
+	assert.Nil(t, os.Mkdir(dir, 0o755))
+	assert.Nil(t, s.StoreE(&httplog.Log{ID: "5", Option: &httplog.Option{}}))
+	waitFor(t, func() bool { return len(up.IDs()) == 4 })
+	assert.Equal(t, []string{"1", "2", "3", "5"}, up.IDs())
+	assert.Equal(t, int64(1), s.Stats().Dropped)
+	assert.Nil(t, s.Close(context.Background()))
+}
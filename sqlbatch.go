@@ -0,0 +1,209 @@
+package httplog
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tableBatch gathers the rows to be inserted into a table.
+type tableBatch struct {
+	schema *tableSchema
+	rows   [][]interface{}
+	logs   []*Log
+}
+
+// EnableBatch enables inserting rows by multi-row insert statements.
+// The rows of a table are flushed when size rows are gathered or the first row has waited maxDelay.
+// Call Close to flush the remaining rows when shutting down.
+func (s *SQLStore) EnableBatch(size int, maxDelay time.Duration) *SQLStore {
+	s.batchMu.Lock()
+	defer s.batchMu.Unlock()
+
+	s.BatchSize = size
+	s.BatchDelay = maxDelay
+
+	if s.batches == nil {
+		s.batches = make(map[string]*tableBatch)
+	}
+
+	if s.batchStop == nil && maxDelay > 0 {
+		s.batchStop = make(chan struct{})
+		s.batchDone = make(chan struct{})
+
+		go s.flushTicker(maxDelay, s.batchStop, s.batchDone)
+	}
+
+	return s
+}
+
+func (s *SQLStore) flushTicker(delay time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(delay)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Flush inserts all the gathered rows.
+func (s *SQLStore) Flush() {
+	s.batchMu.Lock()
+	batches := s.batches
+	s.batches = make(map[string]*tableBatch)
+	s.batchMu.Unlock()
+
+	for _, b := range batches {
+		s.flushBatch(b)
+	}
+}
+
+// Close stops the flush ticker and the schema refreshing, and inserts the remaining rows.
+func (s *SQLStore) Close() error {
+	s.batchMu.Lock()
+	stop, done := s.batchStop, s.batchDone
+	s.batchStop = nil
+	s.batchMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+
+	s.schemaMu.Lock()
+	if s.refreshStop != nil {
+		close(s.refreshStop)
+		s.refreshStop = nil
+	}
+	s.schemaMu.Unlock()
+
+	s.Flush()
+
+	return nil
+}
+
+func (s *SQLStore) addBatch(schema *tableSchema, l *Log) {
+	if len(schema.ValueGetters) == 0 {
+		return
+	}
+
+	row := schema.values(l)
+
+	s.batchMu.Lock()
+
+	if s.batches == nil {
+		s.batches = make(map[string]*tableBatch)
+	}
+
+	var stale *tableBatch
+
+	b := s.batches[schema.Name]
+	if b != nil && b.schema != schema {
+		// the schema is refreshed, the gathered rows go separately.
+		stale, b = b, nil
+	}
+
+	if b == nil {
+		b = &tableBatch{schema: schema}
+		s.batches[schema.Name] = b
+	}
+
+	b.rows = append(b.rows, row)
+	b.logs = append(b.logs, l)
+
+	full := len(b.rows) >= s.BatchSize
+	if full {
+		delete(s.batches, schema.Name)
+	}
+
+	s.batchMu.Unlock()
+
+	if stale != nil {
+		s.flushBatch(stale)
+	}
+
+	if full {
+		s.flushBatch(b)
+	}
+}
+
+// flushBatch inserts the rows of the batch by multi-row inserts,
+// and falls back to insert row by row when a multi-row insert fails,
+// so that one bad row does not lose the whole batch.
+// On an unknown column error, the schema is reloaded and the rows are rebuilt once.
+func (s *SQLStore) flushBatch(b *tableBatch) {
+	refreshed := false
+
+	for start := 0; start < len(b.rows); {
+		n := b.schema.dialect.MaxPlaceholders() / len(b.schema.ValueGetters)
+		if n < 1 {
+			n = 1
+		}
+
+		end := start + n
+		if end > len(b.rows) {
+			end = len(b.rows)
+		}
+
+		if end-start > 1 {
+			err := b.schema.insert(s.DB, b.rows[start:end])
+			if err == nil {
+				start = end
+				continue
+			}
+
+			if !refreshed && s.rebuildBatch(b, err) {
+				refreshed = true
+				continue
+			}
+
+			logrus.Warnf("batch insert %d rows into %s error: %v, fallback to insert row by row",
+				end-start, b.schema.Name, err)
+		}
+
+		for i := start; i < end; i++ {
+			err := b.schema.insert(s.DB, b.rows[i:i+1])
+			if err != nil && !refreshed && s.rebuildBatch(b, err) {
+				refreshed = true
+				err = b.schema.insert(s.DB, b.rows[i:i+1])
+			}
+
+			if err != nil {
+				s.deadLetter(b.logs[i], err)
+			}
+		}
+
+		start = end
+	}
+}
+
+// rebuildBatch rebuilds the rows of the batch by the reloaded schema on an unknown column error.
+func (s *SQLStore) rebuildBatch(b *tableBatch, err error) bool {
+	schema := s.refreshOnUnknownColumn(b.schema.Name, err)
+	if schema == nil {
+		return false
+	}
+
+	b.schema = schema
+
+	for i, l := range b.logs {
+		b.rows[i] = schema.values(l)
+	}
+
+	return true
+}
+
+func (s *SQLStore) deadLetter(l *Log, err error) {
+	logrus.Warnf("do update error: %v", err)
+
+	if s.DeadLetter != nil {
+		s.DeadLetter.Store(l)
+	}
+}
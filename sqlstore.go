@@ -3,6 +3,8 @@ package httplog
 import (
 	"database/sql"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -11,52 +13,227 @@ import (
 type SQLStore struct {
 	DB         *sql.DB
 	DriverName string
-	LogTables  []string
+	// Dialect is the dialect of the database, picked by the DriverName.
+	Dialect   Dialect
+	LogTables []string
 
+	// TableCols caches the schemas of the tables, guarded by schemaMu.
 	TableCols map[string]*tableSchema
+	// Templates maps the partitioned table name patterns, like biz_log_${yyyyMM}, to their template tables.
+	// The template of a pattern not in it is the pattern without the time placeholders, like biz_log.
+	Templates map[string]string
+
+	schemaMu     sync.RWMutex
+	loading      map[string]*schemaCall
+	partitions   map[string]string
+	refreshStop  chan struct{}
+	refreshEvery time.Duration
+
+	// BatchSize is the max number of rows in one multi-row insert, batching is disabled when it is less than 2.
+	BatchSize int
+	// BatchDelay is the max delay of a row waiting in the batch before being inserted.
+	BatchDelay time.Duration
+	// DeadLetter, if not nil, receives the logs failing to be inserted in batch mode.
+	DeadLetter Store
+
+	batchMu   sync.Mutex
+	batches   map[string]*tableBatch
+	batchStop chan struct{}
+	batchDone chan struct{}
 }
 
 // NewSQLStore creates a new SQLStore.
 func NewSQLStore(db *sql.DB, defaultLogTables ...string) *SQLStore {
 	s := &SQLStore{DB: db}
 	s.DriverName = LookupDriverName(db.Driver())
+	s.Dialect = DialectFor(s.DriverName)
 	s.LogTables = defaultLogTables
 	s.TableCols = make(map[string]*tableSchema)
+	s.loading = make(map[string]*schemaCall)
 
 	return s
 }
 
+// schemaCall is an in-flight or completed loading of a table schema.
+type schemaCall struct {
+	wg     sync.WaitGroup
+	schema *tableSchema
+	err    error
+}
+
+// loadTableSchema returns the cached schema of the table, or loads it.
 func (s *SQLStore) loadTableSchema(tableName string) (*tableSchema, error) {
-	if v, ok := s.TableCols[tableName]; ok {
+	s.schemaMu.RLock()
+	v, ok := s.TableCols[tableName]
+	s.schemaMu.RUnlock()
+
+	if ok {
 		return v, nil
 	}
 
-	mapper := NewStructPreparer(TableCol{})
-	run := NewSQLRun(s.DB, mapper)
+	return s.doLoadTableSchema(tableName, false)
+}
 
-	result := run.DoQuery(`
-		 select column_name, column_comment, data_type, character_maximum_length max_length
-		 from information_schema.columns
-		 where table_schema = database()
-		 and table_name = ?`, tableName)
-	if result.Error != nil {
-		return nil, result.Error
+// RefreshSchema reloads the schema of the table, e.g. after an ALTER TABLE adding columns.
+func (s *SQLStore) RefreshSchema(tableName string) error {
+	_, err := s.doLoadTableSchema(tableName, true)
+	return err
+}
+
+// doLoadTableSchema loads the schema of the table, only one loading of a table is in-flight at a time,
+// and the concurrent callers wait for and share its result.
+func (s *SQLStore) doLoadTableSchema(tableName string, refresh bool) (*tableSchema, error) {
+	s.schemaMu.Lock()
+
+	if v, ok := s.TableCols[tableName]; ok && !refresh {
+		s.schemaMu.Unlock()
+		return v, nil
 	}
 
-	tableCols := result.Rows.([]TableCol)
+	if c, ok := s.loading[tableName]; ok {
+		s.schemaMu.Unlock()
+		c.wg.Wait()
+
+		return c.schema, c.err
+	}
+
+	if s.loading == nil {
+		s.loading = make(map[string]*schemaCall)
+	}
+
+	if s.TableCols == nil {
+		s.TableCols = make(map[string]*tableSchema)
+	}
+
+	c := &schemaCall{}
+	c.wg.Add(1)
+	s.loading[tableName] = c
+	s.schemaMu.Unlock()
+
+	c.schema, c.err = s.queryTableSchema(tableName, refresh)
+
+	s.schemaMu.Lock()
+	delete(s.loading, tableName)
+
+	if c.err == nil {
+		s.TableCols[tableName] = c.schema
+	}
+
+	s.schemaMu.Unlock()
+	c.wg.Done()
+
+	return c.schema, c.err
+}
+
+func (s *SQLStore) queryTableSchema(tableName string, refresh bool) (*tableSchema, error) {
+	s.schemaMu.RLock()
+	template, ok := s.partitions[tableName]
+	s.schemaMu.RUnlock()
+
+	if ok {
+		return s.queryPartitionSchema(tableName, template, refresh)
+	}
+
+	tableCols, err := s.Dialect.LoadColumns(s.DB, tableName)
+	if err != nil {
+		return nil, err
+	}
 
 	v := &tableSchema{
-		Name: tableName,
-		Cols: tableCols,
+		Name:    tableName,
+		Cols:    tableCols,
+		dialect: s.Dialect,
 	}
 
 	v.createInsertSQL()
 
-	s.TableCols[tableName] = v
-
 	return v, nil
 }
 
+// RefreshSchemaEvery reloads the schemas of all the loaded tables periodically.
+// Call Close to stop the refreshing.
+func (s *SQLStore) RefreshSchemaEvery(interval time.Duration) *SQLStore {
+	s.schemaMu.Lock()
+	defer s.schemaMu.Unlock()
+
+	if s.refreshStop != nil || interval <= 0 {
+		return s
+	}
+
+	s.refreshEvery = interval
+	s.refreshStop = make(chan struct{})
+
+	go s.refreshTicker(interval, s.refreshStop)
+
+	return s
+}
+
+func (s *SQLStore) refreshTicker(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.refreshSchemas()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// refreshSchemas reloads the schemas of the loaded tables,
+// the partitions are refreshed after their templates, by the reloaded column mapping of the templates.
+func (s *SQLStore) refreshSchemas() {
+	s.schemaMu.RLock()
+	tables := make([]string, 0, len(s.TableCols))
+	partitions := make(map[string]string)
+
+	for t := range s.TableCols {
+		if template, ok := s.partitions[t]; ok {
+			partitions[t] = template
+		} else {
+			tables = append(tables, t)
+		}
+	}
+	s.schemaMu.RUnlock()
+
+	for _, t := range tables {
+		if err := s.RefreshSchema(t); err != nil {
+			logrus.Warnf("failed to refresh schema for table %s, error: %v", t, err)
+		}
+	}
+
+	for t, template := range partitions {
+		ts, err := s.queryPartitionSchema(t, template, false)
+		if err != nil {
+			logrus.Warnf("failed to refresh schema for partition %s, error: %v", t, err)
+			continue
+		}
+
+		s.schemaMu.Lock()
+		s.TableCols[t] = ts
+		s.schemaMu.Unlock()
+	}
+}
+
+// refreshOnUnknownColumn reloads the schema of the table when err is an unknown column error,
+// and returns the new schema, or nil otherwise.
+func (s *SQLStore) refreshOnUnknownColumn(tableName string, err error) *tableSchema {
+	if !s.Dialect.IsUnknownColumn(err) {
+		return nil
+	}
+
+	logrus.Infof("reload schema for table %s on error: %v", tableName, err)
+
+	schema, e := s.doLoadTableSchema(tableName, true)
+	if e != nil || len(schema.ValueGetters) == 0 {
+		return nil
+	}
+
+	return schema
+}
+
 // TableCol defines the schema of a table.
 type TableCol struct {
 	Name      string `name:"column_name"`
@@ -64,25 +241,58 @@ type TableCol struct {
 	DataType  string `name:"data_type"`
 	MaxLength int    `name:"max_length"`
 
-	ValueGetter col `name:"-"`
+	// Tag is the httplog tag parsed from the comment, or the lower-cased column name.
+	Tag         string `name:"-"`
+	ValueGetter col    `name:"-"`
 }
 
 // Store stores the log in database like MySQL, InfluxDB, and etc.
 func (s *SQLStore) Store(l *Log) {
-	tables := l.Option.Tables
-	if len(tables) == 0 {
-		tables = s.LogTables
+	if err := s.StoreE(l); err != nil {
+		logrus.Warnf("failed to store log %s, error: %v", l.ID, err)
+	}
+}
+
+// StoreE stores the log into the log tables, and returns the error when failed.
+// In batch mode, the log is only gathered, and the rows failing to be inserted
+// are sent to the DeadLetter store if it is set.
+func (s *SQLStore) StoreE(l *Log) error {
+	tables := s.LogTables
+	if l.Option != nil && len(l.Option.Tables) > 0 {
+		tables = l.Option.Tables
 	}
 
+	var errs Errors
+
 	for _, t := range tables {
+		t = s.resolveTable(t, l.Created)
+
 		schema, err := s.loadTableSchema(t)
 		if err != nil {
 			logrus.Errorf("failed to loadTableSchema for table %s, error: %v", t, err)
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if s.BatchSize > 1 {
+			s.addBatch(schema, l)
 			continue
 		}
 
-		schema.log(s.DB, l)
+		err = schema.log(s.DB, l)
+		if err != nil {
+			if schema = s.refreshOnUnknownColumn(t, err); schema != nil {
+				err = schema.log(s.DB, l)
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
+
+	return errs.Err()
 }
 
 type tableSchema struct {
@@ -90,26 +300,54 @@ type tableSchema struct {
 	Cols         []TableCol
 	InsertSQL    string
 	ValueGetters []col
+
+	dialect Dialect
+	// columns are the quoted names of the columns to insert.
+	columns []string
+	// insertPrefix is the insert SQL without values, like insert into t(a,b) values.
+	insertPrefix string
 }
 
-func (t tableSchema) log(db MiniDB, l *Log) {
+func (t tableSchema) log(db MiniDB, l *Log) error {
 	if len(t.ValueGetters) == 0 {
-		return
+		return nil
 	}
 
+	return t.insert(db, [][]interface{}{t.values(l)})
+}
+
+func (t tableSchema) values(l *Log) []interface{} {
 	params := make([]interface{}, len(t.ValueGetters))
 	for i, vg := range t.ValueGetters {
 		params[i] = vg.get(l)
 	}
 
-	run := NewSQLExec(db)
-	result := run.DoUpdate(t.InsertSQL, params...)
+	return params
+}
+
+// insert inserts the rows by one multi-row insert statement.
+func (t tableSchema) insert(db MiniDB, rows [][]interface{}) error {
+	query := t.InsertSQL
+	params := rows[0]
+
+	if len(rows) > 1 {
+		params = make([]interface{}, 0, len(rows)*len(t.ValueGetters))
+
+		for _, row := range rows {
+			params = append(params, row...)
+		}
+
+		query = t.insertPrefix + t.marks(len(rows))
+	}
 
+	result := NewSQLExec(db).DoUpdate(query, params...)
 	if result.Error != nil {
-		logrus.Warnf("do update error: %v", result.Error)
-	} else {
-		logrus.Debugf("log result %+v", result)
+		return result.Error
 	}
+
+	logrus.Debugf("log result %+v", result)
+
+	return nil
 }
 
 func (t *tableSchema) createInsertSQL() {
@@ -122,23 +360,83 @@ func (t *tableSchema) createInsertSQL() {
 
 	getters := make([]col, 0, colsNum)
 	columns := make([]string, 0, colsNum)
-	marks := make([]string, 0, colsNum)
 
-	for _, c := range t.Cols {
+	for i := range t.Cols {
+		c := &t.Cols[i]
 		c.parseComment()
 
 		if c.ValueGetter == nil {
 			continue
 		}
 
-		columns = append(columns, c.Name)
-		marks = append(marks, "?")
+		columns = append(columns, t.dialect.Quote(c.Name))
 		getters = append(getters, c.ValueGetter)
 	}
 
-	t.InsertSQL = "insert into " + t.Name + "(" +
-		strings.Join(columns, ",") +
-		") values(" +
-		strings.Join(marks, ",") + ")"
 	t.ValueGetters = getters
+	t.columns = columns
+	t.createInsertPrefix()
+}
+
+func (t *tableSchema) createInsertPrefix() {
+	t.insertPrefix = "insert into " + quoteQualified(t.dialect, t.Name) + "(" + strings.Join(t.columns, ",") + ") values"
+	t.InsertSQL = t.insertPrefix + t.marks(1)
+}
+
+// withName returns a copy of the schema inserting into the table of name, sharing the parsed columns.
+func (t *tableSchema) withName(name string) *tableSchema {
+	v := *t
+	v.Name = name
+	v.createInsertPrefix()
+
+	return &v
+}
+
+// withColumns returns a schema inserting into the table of name by the column mapping of t,
+// limited to the columns in cols, with their max lengths.
+func (t *tableSchema) withColumns(name string, cols []TableCol) *tableSchema {
+	lengths := make(map[string]int, len(cols))
+	for _, c := range cols {
+		lengths[strings.ToLower(c.Name)] = c.MaxLength
+	}
+
+	v := &tableSchema{Name: name, dialect: t.dialect}
+
+	for _, c := range t.Cols {
+		if n, ok := lengths[strings.ToLower(c.Name)]; ok {
+			c.MaxLength = n
+			v.Cols = append(v.Cols, c)
+		}
+	}
+
+	v.createInsertSQL()
+
+	return v
+}
+
+// marks returns the placeholders of rows, like (?,?),(?,?) or ($1,$2),($3,$4).
+func (t *tableSchema) marks(rows int) string {
+	var b strings.Builder
+
+	cols := len(t.ValueGetters)
+
+	for r := 0; r < rows; r++ {
+		if r > 0 {
+			b.WriteString(",")
+		}
+
+		b.WriteString("(")
+
+		for c := 0; c < cols; c++ {
+			if c > 0 {
+				b.WriteString(",")
+			}
+
+			b.WriteString(t.dialect.Placeholder(r*cols + c))
+		}
+
+		b.WriteString(")")
+	}
+
+	return b.String()
 }
@@ -2,10 +2,14 @@ package httplog_test
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 
@@ -30,3 +34,249 @@ func TestNewSQLStore(t *testing.T) {
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, r)
 }
+
+func TestSQLStoreBatch(t *testing.T) {
+	f := &fakeDB{
+		query: fakeColumns(
+			[]driver.Value{"id", "", "bigint", nil},
+			[]driver.Value{"biz", "", "varchar", int64(60)},
+		),
+		exec: func(query string, args []driver.Value) error {
+			for _, arg := range args {
+				if arg == "bad" {
+					return fmt.Errorf("bad row")
+				}
+			}
+
+			return nil
+		},
+	}
+
+	store := httplog.NewSQLStore(openFakeDB(f), "biz_log").EnableBatch(3, time.Hour)
+
+	for _, biz := range []string{"a", "bad", "c", "d"} {
+		store.Store(&httplog.Log{ID: biz, Biz: biz, Option: &httplog.Option{}})
+	}
+
+	assert.Nil(t, store.Close())
+	assert.Equal(t, []fakeExec{
+		{Query: "insert into `biz_log`(`id`,`biz`) values(?,?),(?,?),(?,?)", Args: []driver.Value{"a", "a", "bad", "bad", "c", "c"}},
+		{Query: "insert into `biz_log`(`id`,`biz`) values(?,?)", Args: []driver.Value{"a", "a"}},
+		{Query: "insert into `biz_log`(`id`,`biz`) values(?,?)", Args: []driver.Value{"bad", "bad"}},
+		{Query: "insert into `biz_log`(`id`,`biz`) values(?,?)", Args: []driver.Value{"c", "c"}},
+		{Query: "insert into `biz_log`(`id`,`biz`) values(?,?)", Args: []driver.Value{"d", "d"}},
+	}, f.Execs())
+}
+
+func TestSQLStoreBatchMaxPlaceholders(t *testing.T) {
+	f := &fakeDB{
+		query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			switch {
+			case strings.Contains(query, "sqlite_master"):
+				return []string{"sql"}, [][]driver.Value{{"create table biz_log(id integer, biz varchar(60))"}}, nil
+			case strings.Contains(query, "pragma table_info"):
+				return []string{"cid", "name", "type", "notnull", "dflt_value", "pk"}, [][]driver.Value{
+					{int64(0), "id", "INTEGER", int64(0), nil, int64(0)},
+					{int64(1), "biz", "VARCHAR(60)", int64(0), nil, int64(0)},
+				}, nil
+			}
+
+			return nil, nil, fmt.Errorf("unexpected query %s", query)
+		},
+	}
+
+	store := httplog.NewSQLStore(openFakeDB(f), "biz_log")
+	store.Dialect = httplog.DialectFor("sqlite3")
+	store.EnableBatch(600, time.Hour)
+
+	for i := 0; i < 600; i++ {
+		store.Store(&httplog.Log{ID: fmt.Sprint(i), Biz: "biz", Option: &httplog.Option{}})
+	}
+
+	assert.Nil(t, store.Close())
+
+	execs := f.Execs()
+	assert.Len(t, execs, 2)
+	// 999 placeholders of SQLite at most, 499 rows of 2 columns.
+	assert.Len(t, execs[0].Args, 998)
+	assert.Len(t, execs[1].Args, 202)
+}
+
+func TestSQLStoreDialect(t *testing.T) {
+	f := &fakeDB{
+		query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			switch {
+			case strings.Contains(query, "sqlite_master"):
+				return []string{"sql"}, [][]driver.Value{{"create table biz_log(\n" +
+					"  id   integer primary key, -- 日志记录ID\n" +
+					"  \"end\" datetime,\n" +
+					"  ua   varchar(10)          -- httplog:\"req_head_User-Agent\"\n)"}}, nil
+			case strings.Contains(query, "pragma table_info"):
+				return []string{"cid", "name", "type", "notnull", "dflt_value", "pk"}, [][]driver.Value{
+					{int64(0), "id", "INTEGER", int64(0), nil, int64(1)},
+					{int64(1), "end", "DATETIME", int64(0), nil, int64(0)},
+					{int64(2), "ua", "VARCHAR(10)", int64(0), nil, int64(0)},
+				}, nil
+			}
+
+			return nil, nil, fmt.Errorf("unexpected query %s", query)
+		},
+	}
+
+	store := httplog.NewSQLStore(openFakeDB(f), "biz_log")
+	store.Dialect = httplog.DialectFor("sqlite3")
+
+	end := time.Now()
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0)")
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "1", End: end, ReqHeader: r.Header, Request: r}))
+	assert.Equal(t, []fakeExec{{
+		Query: `insert into "biz_log"("id","end","ua") values(?,?,?)`,
+		Args:  []driver.Value{"1", end, "Mozilla..."},
+	}}, f.Execs())
+
+	assert.Equal(t, "$1", httplog.DialectFor("pgx").Placeholder(0))
+	assert.Equal(t, `"a""b"`, httplog.DialectFor("postgres").Quote(`a"b`))
+	assert.Equal(t, "`end`", httplog.DialectFor("mysql").Quote("end"))
+}
+
+func TestSQLStoreRefreshSchema(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		loads   int
+		cols    = [][]driver.Value{{"id", "", "bigint", nil}}
+		release = make(chan struct{})
+	)
+
+	f := &fakeDB{
+		query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			<-release
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			loads++
+
+			return fakeColumns(cols...)(query, args)
+		},
+		exec: func(query string, args []driver.Value) error {
+			if strings.Contains(query, "`biz`") {
+				return nil
+			}
+
+			return fmt.Errorf("Error 1054: Unknown column 'biz' in 'field list'")
+		},
+	}
+
+	store := httplog.NewSQLStore(openFakeDB(f), "biz_log")
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, store.RefreshSchema("biz_log"))
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 1, loads)
+
+	// the column biz is added, the unknown column error reloads the schema and retries.
+	mu.Lock()
+	cols = append(cols, []driver.Value{"biz", "", "varchar", int64(60)})
+	mu.Unlock()
+
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "1", Biz: "b", Option: &httplog.Option{}}))
+	assert.Equal(t, 2, loads)
+	assert.Equal(t, []fakeExec{
+		{Query: "insert into `biz_log`(`id`) values(?)", Args: []driver.Value{"1"}},
+		{Query: "insert into `biz_log`(`id`,`biz`) values(?,?)", Args: []driver.Value{"1", "b"}},
+	}, f.Execs())
+}
+
+func TestSQLStorePartition(t *testing.T) {
+	f := &fakeDB{query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+		if !strings.HasPrefix(args[0].(string), "biz_log") {
+			return nil, nil, fmt.Errorf("unexpected table %v", args[0])
+		}
+
+		return fakeColumns([]driver.Value{"id", "", "bigint", nil})(query, args)
+	}}
+
+	store := httplog.NewSQLStore(openFakeDB(f), "biz_log_${yyyyMM}")
+
+	jan := time.Date(2021, 1, 2, 0, 0, 0, 0, time.Local)
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "1", Created: jan}))
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "2", Created: jan.Add(time.Hour)}))
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "3", Created: jan.AddDate(0, 1, 0)}))
+
+	assert.Equal(t, []fakeExec{
+		{Query: "create table if not exists `biz_log_202101` like `biz_log`", Args: []driver.Value{}},
+		{Query: "insert into `biz_log_202101`(`id`) values(?)", Args: []driver.Value{"1"}},
+		{Query: "insert into `biz_log_202101`(`id`) values(?)", Args: []driver.Value{"2"}},
+		{Query: "create table if not exists `biz_log_202102` like `biz_log`", Args: []driver.Value{}},
+		{Query: "insert into `biz_log_202102`(`id`) values(?)", Args: []driver.Value{"3"}},
+	}, f.Execs())
+
+	assert.Equal(t, "log_2021_0102", httplog.PartitionName("log_${yyyy}_${MMdd}", jan))
+	assert.False(t, httplog.IsPartitioned("biz_log"))
+}
+
+func TestSQLStorePartitionTemplateAltered(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		tables = map[string][][]driver.Value{"biz_log": {{"id", "", "bigint", nil}}}
+	)
+
+	f := &fakeDB{
+		query: func(query string, args []driver.Value) ([]string, [][]driver.Value, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return fakeColumns(tables[args[0].(string)]...)(query, args)
+		},
+		exec: func(query string, args []driver.Value) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			// create table if not exists `biz_log_202101` like `biz_log`
+			if strings.HasPrefix(query, "create table") {
+				name := strings.Trim(strings.Fields(query)[5], "`")
+				if _, ok := tables[name]; !ok {
+					tables[name] = tables["biz_log"]
+				}
+			}
+
+			return nil
+		},
+	}
+
+	store := httplog.NewSQLStore(openFakeDB(f), "biz_log_${yyyyMM}")
+
+	jan := time.Date(2021, 1, 2, 0, 0, 0, 0, time.Local)
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "1", Biz: "b", Created: jan}))
+
+	// the template gains the column biz, after the partition of January is created.
+	mu.Lock()
+	tables["biz_log"] = [][]driver.Value{{"id", "", "bigint", nil}, {"biz", "", "varchar", int64(60)}}
+	mu.Unlock()
+
+	assert.Nil(t, store.RefreshSchema("biz_log"))
+	assert.Nil(t, store.RefreshSchema("biz_log_202101"))
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "2", Biz: "b", Created: jan}))
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "3", Biz: "b", Created: jan.AddDate(0, 1, 0)}))
+
+	assert.Equal(t, []fakeExec{
+		{Query: "create table if not exists `biz_log_202101` like `biz_log`", Args: []driver.Value{}},
+		{Query: "insert into `biz_log_202101`(`id`) values(?)", Args: []driver.Value{"1"}},
+		{Query: "create table if not exists `biz_log_202101` like `biz_log`", Args: []driver.Value{}},
+		{Query: "insert into `biz_log_202101`(`id`) values(?)", Args: []driver.Value{"2"}},
+		{Query: "create table if not exists `biz_log_202102` like `biz_log`", Args: []driver.Value{}},
+		{Query: "insert into `biz_log_202102`(`id`,`biz`) values(?,?)", Args: []driver.Value{"3", "b"}},
+	}, f.Execs())
+}
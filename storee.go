@@ -0,0 +1,156 @@
+package httplog
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StoreE defines the interface to store a log, reporting the failure.
+type StoreE interface {
+	// StoreE stores the log, and returns the error when failed.
+	StoreE(log *Log) error
+}
+
+// storeE adapts a Store which does not report failure to StoreE.
+type storeE struct{ Store }
+
+// StoreE stores the log and always succeeds.
+func (s storeE) StoreE(log *Log) error {
+	s.Store.Store(log)
+	return nil
+}
+
+// AsStoreE adapts the store to StoreE.
+// The store is returned as it is when it implements StoreE already,
+// otherwise the returned StoreE always succeeds.
+func AsStoreE(store Store) StoreE {
+	if s, ok := store.(StoreE); ok {
+		return s
+	}
+
+	return storeE{Store: store}
+}
+
+// ErrDropped is the error when a log is dropped without being stored.
+var ErrDropped = errors.New("log dropped")
+
+// Errors is the error collecting multiple errors.
+type Errors []error
+
+// Error returns the errors joined by semicolons.
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+
+	return strings.Join(s, "; ")
+}
+
+// Err returns nil if there is no error, or the only one, or the Errors itself.
+func (e Errors) Err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	default:
+		return e
+	}
+}
+
+// Backoff defines the exponential backoff between retries.
+type Backoff struct {
+	// Retries is the max number of retries after the first failure.
+	Retries int
+	// Initial is the delay before the first retry.
+	Initial time.Duration
+	// Max is the max delay between retries.
+	Max time.Duration
+	// Multiplier multiplies the delay after each retry, 2 when it is less than 1.
+	Multiplier float64
+}
+
+// DefaultBackoff returns a Backoff with 3 retries, delaying 100ms, 200ms, 400ms.
+func DefaultBackoff() Backoff {
+	return Backoff{Retries: 3, Initial: 100 * time.Millisecond, Max: 10 * time.Second, Multiplier: 2}
+}
+
+// Do calls fn until it succeeds or the retries are used up, and returns the last error.
+func (b Backoff) Do(fn func() error) error {
+	err := fn()
+	delay := b.Initial
+
+	for i := 0; err != nil && i < b.Retries; i++ {
+		time.Sleep(delay)
+
+		delay = b.next(delay)
+		err = fn()
+	}
+
+	return err
+}
+
+// next returns the delay after the current one.
+func (b Backoff) next(delay time.Duration) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	if delay = time.Duration(float64(delay) * multiplier); b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+
+	return delay
+}
+
+// storeWithRetry stores the log by store with retries,
+// and sends the log to the deadLetter when all the retries fail.
+func storeWithRetry(store StoreE, backoff *Backoff, deadLetter Store, l *Log) error {
+	fn := func() error { return store.StoreE(l) }
+
+	var err error
+
+	if backoff != nil {
+		err = backoff.Do(fn)
+	} else {
+		err = fn()
+	}
+
+	if err == nil || deadLetter == nil {
+		return err
+	}
+
+	logrus.Warnf("failed to store log %s, send it to the dead letter store, error: %v", l.ID, err)
+
+	return AsStoreE(deadLetter).StoreE(l)
+}
+
+// RetryStore wraps a store with retries and a dead letter store.
+type RetryStore struct {
+	store      StoreE
+	Backoff    Backoff
+	DeadLetter Store
+}
+
+// NewRetryStore creates a new RetryStore.
+// The logs still failing after the retries are sent to the deadLetter store if it is not nil.
+func NewRetryStore(store Store, backoff Backoff, deadLetter Store) *RetryStore {
+	return &RetryStore{store: AsStoreE(store), Backoff: backoff, DeadLetter: deadLetter}
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *RetryStore) Store(log *Log) {
+	if err := s.StoreE(log); err != nil {
+		logrus.Warnf("failed to store log %s, error: %v", log.ID, err)
+	}
+}
+
+// StoreE stores the log with retries, and returns the error when the dead letter store also fails.
+func (s *RetryStore) StoreE(log *Log) error {
+	return storeWithRetry(s.store, &s.Backoff, s.DeadLetter, log)
+}
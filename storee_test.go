@@ -0,0 +1,66 @@
+package httplog_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyStore fails the first failures calls.
+type flakyStore struct {
+	failures int
+	calls    int
+}
+
+func (s *flakyStore) Store(l *httplog.Log) { _ = s.StoreE(l) }
+
+func (s *flakyStore) StoreE(*httplog.Log) error {
+	s.calls++
+
+	if s.calls <= s.failures {
+		return errors.New("database is down")
+	}
+
+	return nil
+}
+
+func TestRetryStore(t *testing.T) {
+	backoff := httplog.Backoff{Retries: 2, Initial: time.Millisecond}
+
+	fs := &flakyStore{failures: 2}
+	assert.Nil(t, httplog.NewRetryStore(fs, backoff, nil).StoreE(&httplog.Log{ID: "1"}))
+	assert.Equal(t, 3, fs.calls)
+
+	dir, err := ioutil.TempDir("", "httplog")
+	assert.Nil(t, err)
+
+	defer os.RemoveAll(dir)
+
+	dl, err := httplog.NewDeadLetterFile(filepath.Join(dir, "dead.jsonl"))
+	assert.Nil(t, err)
+
+	fs = &flakyStore{failures: 100}
+	stores := httplog.NewStores(fs, httplog.NewLogrusStore()).WithRetry(backoff, dl)
+	assert.Nil(t, stores.StoreE(&httplog.Log{ID: "2", Biz: "biz", Option: &httplog.Option{Tables: []string{"t1"}}}))
+	assert.Equal(t, 3, fs.calls)
+	assert.Nil(t, dl.Close())
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "dead.jsonl"))
+	assert.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 1)
+
+	var r httplog.LogRecord
+
+	assert.Nil(t, httplog.JSONUnmarshal([]byte(lines[0]), &r))
+	assert.Equal(t, "2", r.ID)
+	assert.Equal(t, []string{"t1"}, r.Log().Option.Tables)
+}
@@ -0,0 +1,177 @@
+package httplog
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxInFlight is the max number of the logs being stored into a sink in background,
+// the newer logs are dropped for the sink when reached, like when it hangs.
+const maxInFlight = 100
+
+// StoreHealth is the health status of a sink of Stores.
+type StoreHealth struct {
+	// Store is the type of the store, like *httplog.SQLStore.
+	Store string `json:"store"`
+	// Healthy tells whether the last storing succeeded.
+	Healthy  bool   `json:"healthy"`
+	Stored   uint64 `json:"stored"`
+	Failed   uint64 `json:"failed"`
+	Timeouts uint64 `json:"timeouts"`
+	Panics   uint64 `json:"panics"`
+	Dropped  uint64 `json:"dropped"`
+	// InFlight is the number of the logs being stored.
+	InFlight int64 `json:"inFlight"`
+
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime,omitempty"`
+}
+
+type storeHealth struct {
+	inFlight int64
+
+	mu sync.Mutex
+	StoreHealth
+}
+
+func (h *storeHealth) record(err error, timeout, panicked bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case err == nil:
+		h.Stored++
+		h.Healthy = true
+
+		return
+	case timeout:
+		h.Timeouts++
+	case panicked:
+		h.Panics++
+		h.Failed++
+	case err == ErrDropped:
+		h.Dropped++
+	default:
+		h.Failed++
+	}
+
+	h.Healthy = false
+	h.LastError = err.Error()
+	h.LastErrorTime = time.Now()
+}
+
+// Health returns the health status of the stores, in the order of Composite.
+func (s *Stores) Health() []StoreHealth {
+	result := make([]StoreHealth, len(s.Composite))
+
+	for i, v := range s.Composite {
+		h := s.sink(i, v)
+
+		h.mu.Lock()
+		result[i] = h.StoreHealth
+		h.mu.Unlock()
+
+		result[i].InFlight = atomic.LoadInt64(&h.inFlight)
+	}
+
+	return result
+}
+
+// sink returns the health of the i-th store.
+func (s *Stores) sink(i int, store Store) *storeHealth {
+	s.healthMu.Lock()
+	defer s.healthMu.Unlock()
+
+	for len(s.health) <= i {
+		s.health = append(s.health, nil)
+	}
+
+	if s.health[i] == nil {
+		s.health[i] = &storeHealth{StoreHealth: StoreHealth{Store: fmt.Sprintf("%T", store), Healthy: true}}
+	}
+
+	return s.health[i]
+}
+
+// storeInto stores the log into the store with retries, recovering the panic as the error.
+func (s *Stores) storeInto(h *storeHealth, store Store, log *Log) (err error) {
+	atomic.AddInt64(&h.inFlight, 1)
+
+	defer func() {
+		atomic.AddInt64(&h.inFlight, -1)
+
+		r := recover()
+		if r != nil {
+			err = fmt.Errorf("store %T panic: %v", store, r)
+		}
+
+		h.record(err, false, r != nil)
+	}()
+
+	return storeWithRetry(AsStoreE(store), s.Backoff, s.DeadLetter, log)
+}
+
+type storeResult struct {
+	i   int
+	err error
+}
+
+// storeParallel stores the log into the stores concurrently, and waits for them until the timeout.
+func (s *Stores) storeParallel(log *Log) error {
+	var errs Errors
+
+	results := make(chan storeResult, len(s.Composite))
+	sinks := make([]*storeHealth, len(s.Composite))
+	pending := 0
+
+	for i, v := range s.Composite {
+		h := s.sink(i, v)
+
+		if atomic.LoadInt64(&h.inFlight) >= maxInFlight {
+			h.record(ErrDropped, false, false)
+			errs = append(errs, fmt.Errorf("store %T: %w", v, ErrDropped))
+
+			continue
+		}
+
+		sinks[i] = h
+		pending++
+
+		go func(i int, v Store) { results <- storeResult{i: i, err: s.storeInto(h, v, log)} }(i, v)
+	}
+
+	var timeout <-chan time.Time
+
+	if s.Timeout > 0 && pending > 0 {
+		t := time.NewTimer(s.Timeout)
+		defer t.Stop()
+
+		timeout = t.C
+	}
+
+	for pending > 0 {
+		select {
+		case r := <-results:
+			sinks[r.i] = nil
+			pending--
+
+			if r.err != nil {
+				errs = append(errs, r.err)
+			}
+		case <-timeout:
+			for i, h := range sinks {
+				if h != nil {
+					err := fmt.Errorf("store %T timeout after %s", s.Composite[i], s.Timeout)
+					h.record(err, true, false)
+					errs = append(errs, err)
+				}
+			}
+
+			return errs.Err()
+		}
+	}
+
+	return errs.Err()
+}
@@ -0,0 +1,53 @@
+package httplog_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+type panicStore struct{}
+
+func (panicStore) Store(*httplog.Log) { panic("boom") }
+
+func TestStoresParallel(t *testing.T) {
+	slow := &blockingStore{release: make(chan struct{})}
+	good := make(chanStore, 2)
+	stores := httplog.NewStores(slow, panicStore{}, good).WithParallel(50 * time.Millisecond)
+
+	start := time.Now()
+	err := stores.StoreE(&httplog.Log{ID: "1"})
+	assert.True(t, time.Since(start) < time.Second)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "panic: boom"), err.Error())
+	assert.True(t, strings.Contains(err.Error(), "timeout after 50ms"), err.Error())
+	assert.Equal(t, "1", (<-good).ID)
+
+	health := stores.Health()
+	assert.Equal(t, "*httplog_test.blockingStore", health[0].Store)
+	assert.False(t, health[0].Healthy)
+	assert.Equal(t, uint64(1), health[0].Timeouts)
+	assert.Equal(t, int64(1), health[0].InFlight)
+	assert.False(t, health[1].Healthy)
+	assert.Equal(t, uint64(1), health[1].Panics)
+	assert.Equal(t, "store httplog_test.panicStore panic: boom", health[1].LastError)
+	assert.True(t, health[2].Healthy)
+	assert.Equal(t, uint64(1), health[2].Stored)
+
+	close(slow.release)
+
+	for stores.Health()[0].InFlight > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.True(t, stores.Health()[0].Healthy)
+	assert.Equal(t, []string{"1"}, slow.ids)
+
+	// the panic is recovered in the sequential mode too.
+	stores = httplog.NewStores(panicStore{}, good)
+	assert.NotNil(t, stores.StoreE(&httplog.Log{ID: "2"}))
+	assert.Equal(t, "2", (<-good).ID)
+}
@@ -0,0 +1,315 @@
+package httplog
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SyslogJSON formats the message body as the JSON of the fields.
+	SyslogJSON = "json"
+	// SyslogKV formats the message body as the key=value pairs of the fields.
+	SyslogKV = "kv"
+)
+
+// SyslogOption defines the option of SyslogStore.
+type SyslogOption struct {
+	// Facility is the syslog facility, default 16 (local0).
+	Facility int
+	// Hostname is the HOSTNAME of the messages, default os.Hostname().
+	Hostname string
+	// AppName is the APP-NAME of the messages, default httplog.
+	AppName string
+	// SDID is the SD-ID of the structured-data element holding biz, status and cost, default httplog@32473.
+	SDID string
+	// Format is the format of the message body, SyslogJSON (default) or SyslogKV.
+	Format string
+	// Fields maps the message body fields to the log values, default DefaultFieldMapping().
+	Fields FieldMapping
+	// Timeout is the timeout of dialing and writing, default 5s.
+	Timeout time.Duration
+	// Backoff reconnects and rewrites the failed messages, default DefaultBackoff().
+	Backoff Backoff
+}
+
+// SyslogOptionFn defines the function prototype to setting SyslogOption.
+type SyslogOptionFn func(o *SyslogOption)
+
+// SyslogFacility set the syslog facility, like 1 for user, 16 for local0.
+func SyslogFacility(facility int) SyslogOptionFn {
+	return func(o *SyslogOption) { o.Facility = facility }
+}
+
+// SyslogHostname set the HOSTNAME of the messages.
+func SyslogHostname(hostname string) SyslogOptionFn {
+	return func(o *SyslogOption) { o.Hostname = hostname }
+}
+
+// SyslogAppName set the APP-NAME of the messages.
+func SyslogAppName(appName string) SyslogOptionFn {
+	return func(o *SyslogOption) { o.AppName = appName }
+}
+
+// SyslogSDID set the SD-ID of the structured-data element.
+func SyslogSDID(sdID string) SyslogOptionFn { return func(o *SyslogOption) { o.SDID = sdID } }
+
+// SyslogFormat set the format of the message body, SyslogJSON or SyslogKV.
+func SyslogFormat(format string) SyslogOptionFn { return func(o *SyslogOption) { o.Format = format } }
+
+// SyslogFields set the mapping of the message body fields.
+func SyslogFields(fields FieldMapping) SyslogOptionFn {
+	return func(o *SyslogOption) { o.Fields = fields }
+}
+
+// SyslogTimeout set the timeout of dialing and writing.
+func SyslogTimeout(timeout time.Duration) SyslogOptionFn {
+	return func(o *SyslogOption) { o.Timeout = timeout }
+}
+
+// SyslogRetry set the backoff to reconnect and rewrite the failed messages.
+func SyslogRetry(backoff Backoff) SyslogOptionFn {
+	return func(o *SyslogOption) { o.Backoff = backoff }
+}
+
+// SyslogStore writes the logs as RFC 5424 messages to a syslog server like rsyslog,
+// over UDP, TCP with octet-counting framing, or the unix socket like /dev/log.
+type SyslogStore struct {
+	network string
+	addr    string
+	option  *SyslogOption
+	getters fieldGetters
+	procID  string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	stream bool
+}
+
+// NewSyslogStore creates a new SyslogStore, the network is udp, tcp or unix,
+// like ("udp", "127.0.0.1:514"), ("tcp", "127.0.0.1:601") or ("unix", "/dev/log").
+// The error is returned when the first connection fails.
+func NewSyslogStore(network, addr string, fns ...SyslogOptionFn) (*SyslogStore, error) {
+	hostname, _ := os.Hostname()
+	option := &SyslogOption{
+		Facility: 16,
+		Hostname: hostname,
+		AppName:  "httplog",
+		SDID:     "httplog@32473",
+		Format:   SyslogJSON,
+		Fields:   DefaultFieldMapping(),
+		Timeout:  5 * time.Second,
+		Backoff:  DefaultBackoff(),
+	}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	switch option.Format {
+	case SyslogJSON, SyslogKV:
+	default:
+		return nil, fmt.Errorf("unknown syslog format %s", option.Format)
+	}
+
+	s := &SyslogStore{
+		network: network,
+		addr:    addr,
+		option:  option,
+		getters: option.Fields.compile(),
+		procID:  strconv.Itoa(os.Getpid()),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// connect dials the server, the unix network tries the datagram socket first, then the stream socket.
+func (s *SyslogStore) connect() error {
+	networks := []string{s.network}
+	if s.network == "unix" {
+		networks = []string{"unixgram", "unix"}
+	}
+
+	var err error
+
+	for _, network := range networks {
+		var conn net.Conn
+
+		if conn, err = net.DialTimeout(network, s.addr, s.option.Timeout); err == nil {
+			s.conn = conn
+			s.stream = network == "tcp" || network == "tcp4" || network == "tcp6" || network == "unix"
+
+			return nil
+		}
+	}
+
+	return err
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *SyslogStore) Store(log *Log) {
+	if err := s.StoreE(log); err != nil {
+		logrus.Warnf("failed to write log %s to syslog %s, error: %v", log.ID, s.addr, err)
+	}
+}
+
+// StoreE writes the message of the log, reconnecting when the write fails.
+func (s *SyslogStore) StoreE(log *Log) error {
+	msg, err := s.Message(log)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.option.Backoff.Do(func() error {
+		if s.conn == nil {
+			if err := s.connect(); err != nil {
+				return err
+			}
+		}
+
+		frame := msg
+		if s.stream {
+			frame = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+
+		_ = s.conn.SetWriteDeadline(time.Now().Add(s.option.Timeout))
+
+		if _, err := s.conn.Write(frame); err != nil {
+			_ = s.conn.Close()
+			s.conn = nil
+
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Close closes the connection.
+func (s *SyslogStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
+
+// Message returns the RFC 5424 message of the log, without framing.
+func (s *SyslogStore) Message(l *Log) ([]byte, error) {
+	t := l.Start
+	if t.IsZero() {
+		t = l.Created
+	}
+
+	timestamp := "-"
+	if !t.IsZero() {
+		timestamp = t.Format("2006-01-02T15:04:05.000000Z07:00")
+	}
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s [%s biz=\"%s\" status=\"%d\" cost=\"%d\"] ",
+		s.option.Facility*8+SyslogSeverity(l.RspStatus), timestamp,
+		syslogHeader(s.option.Hostname, 255), syslogHeader(s.option.AppName, 48), s.procID, syslogHeader(l.ID, 32),
+		s.option.SDID, syslogParam(l.Biz), l.RspStatus, l.Duration.Milliseconds())
+
+	if s.option.Format == SyslogKV {
+		s.writeKV(&b, l)
+		return b.Bytes(), nil
+	}
+
+	if err := s.getters.writeJSON(&b, l); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// writeKV writes the fields as key=value pairs sorted by the keys, the values with spaces, quotes or = are quoted.
+func (s *SyslogStore) writeKV(b *bytes.Buffer, l *Log) {
+	sep := ""
+
+	for _, f := range s.getters {
+		v := f.col.get(l)
+		if v == nil {
+			continue
+		}
+
+		var str string
+
+		switch x := v.(type) {
+		case time.Time:
+			str = x.Format(time.RFC3339Nano)
+		case string:
+			str = x
+		default:
+			str = fmt.Sprintf("%v", x)
+		}
+
+		if str == "" || strings.ContainsAny(str, " \"=\t\r\n") {
+			str = strconv.Quote(str)
+		}
+
+		b.WriteString(sep + f.name + "=" + str)
+		sep = " "
+	}
+}
+
+// SyslogSeverity returns the syslog severity of the response status,
+// 3 (error) for 5xx, 4 (warning) for 4xx, and 6 (informational) for the others.
+func SyslogSeverity(status int) int {
+	switch {
+	case status >= 500:
+		return 3
+	case status >= 400:
+		return 4
+	default:
+		return 6
+	}
+}
+
+// syslogHeader returns the header field limited to the printable US-ASCII chars and the max length, or - when empty.
+func syslogHeader(s string, max int) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s) && b.Len() < max; i++ {
+		if s[i] > 32 && s[i] < 127 {
+			b.WriteByte(s[i])
+		}
+	}
+
+	if b.Len() == 0 {
+		return "-"
+	}
+
+	return b.String()
+}
+
+// nolint:gochecknoglobals
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// syslogParam escapes the structured-data param value.
+func syslogParam(v string) string { return syslogParamEscaper.Replace(v) }
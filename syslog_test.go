@@ -0,0 +1,92 @@
+package httplog_test
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyslogStore(t *testing.T) {
+	l := &httplog.Log{ID: "1", Biz: `say "hi"`, Method: "GET", URL: "/hello", RspStatus: 503,
+		Start: time.Date(2021, 1, 2, 3, 4, 5, 6000, time.UTC), Duration: 3 * time.Millisecond}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	defer pc.Close()
+
+	store, err := httplog.NewSyslogStore("udp", pc.LocalAddr().String(), httplog.SyslogHostname("host"),
+		httplog.SyslogFields(httplog.FieldMapping{"method": "req_method", "url": "req_url"}))
+	assert.Nil(t, err)
+	assert.Nil(t, store.StoreE(l))
+	assert.Nil(t, store.Close())
+
+	buf := make([]byte, 2048)
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	assert.Nil(t, err)
+
+	prefix := `<131>1 2021-01-02T03:04:05.000006Z host httplog `
+	msg := string(buf[:n])
+	assert.True(t, strings.HasPrefix(msg, prefix), msg)
+	assert.True(t, strings.HasSuffix(msg,
+		` 1 [httplog@32473 biz="say \"hi\"" status="503" cost="3"] {"method":"GET","url":"/hello"}`), msg)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	defer ln.Close()
+
+	frames := make(chan string, 10)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			// reads one octet-counted frame per connection, then drops it to force a reconnect.
+			r := bufio.NewReader(conn)
+			size, _ := r.ReadString(' ')
+			n, _ := strconv.Atoi(strings.TrimSpace(size))
+			frame := make([]byte, n)
+			_, _ = r.Read(frame)
+			frames <- string(frame)
+			_ = conn.Close()
+		}
+	}()
+
+	store, err = httplog.NewSyslogStore("tcp", ln.Addr().String(), httplog.SyslogFormat(httplog.SyslogKV),
+		httplog.SyslogFields(httplog.FieldMapping{"method": "req_method", "url": "req_url", "biz": "biz"}),
+		httplog.SyslogRetry(httplog.Backoff{Retries: 3, Initial: 10 * time.Millisecond}))
+	assert.Nil(t, err)
+
+	defer store.Close()
+
+	l.RspStatus = 200
+	assert.Nil(t, store.StoreE(l))
+	assert.True(t, strings.HasSuffix(<-frames, `] biz="say \"hi\"" method=GET url=/hello`))
+
+	// the dropped connection fails the writes sooner or later, then it reconnects.
+	deadline := time.After(5 * time.Second)
+
+	for {
+		store.Store(l)
+
+		select {
+		case frame := <-frames:
+			assert.True(t, strings.HasPrefix(frame, "<134>1 "), frame)
+			return
+		case <-deadline:
+			t.Fatal("no reconnect")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
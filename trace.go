@@ -0,0 +1,124 @@
+package httplog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TraceparentHeader is the W3C trace context header carrying the trace ID, parent span ID and flags.
+	TraceparentHeader = "traceparent"
+	// TracestateHeader is the W3C trace context header carrying the vendor-specific trace data.
+	TracestateHeader = "tracestate"
+)
+
+// TraceContext is the W3C trace context of a request.
+type TraceContext struct {
+	// TraceID is 32 lowercase hex digits.
+	TraceID string
+	// SpanID is 16 lowercase hex digits of the span of the request.
+	SpanID string
+	// ParentSpanID is 16 lowercase hex digits of the caller span, empty for a new trace.
+	ParentSpanID string
+	// Flags is the 2 hex digits trace flags, like 01 for sampled.
+	Flags string
+	// State is the tracestate header, passed through as is.
+	State string
+}
+
+// ParseTraceparent parses the traceparent header like 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01,
+// false is returned when it is invalid.
+func ParseTraceparent(header string) (t TraceContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || !isHex(parts[0], 2) || parts[0] == "ff" || parts[0] == "00" && len(parts) != 4 {
+		return t, false
+	}
+
+	if !isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) {
+		return t, false
+	}
+
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return t, false
+	}
+
+	return TraceContext{TraceID: parts[1], ParentSpanID: parts[2], Flags: parts[3]}, true
+}
+
+// NewTraceContext continues the trace of the traceparent/tracestate headers of the request with a new span,
+// or starts a new sampled trace when the headers are absent or invalid.
+func NewTraceContext(r *http.Request) TraceContext {
+	t, ok := ParseTraceparent(r.Header.Get(TraceparentHeader))
+	if ok {
+		t.State = r.Header.Get(TracestateHeader)
+	} else {
+		t = TraceContext{TraceID: randomHex(16), Flags: "01"}
+	}
+
+	t.SpanID = randomHex(8)
+
+	return t
+}
+
+// Traceparent returns the traceparent header value to propagate the trace to the downstream services.
+func (t TraceContext) Traceparent() string {
+	return "00-" + t.TraceID + "-" + t.SpanID + "-" + t.Flags
+}
+
+// Inject sets the traceparent and tracestate headers, like for an outgoing request.
+func (t TraceContext) Inject(h http.Header) {
+	h.Set(TraceparentHeader, t.Traceparent())
+
+	if t.State != "" {
+		h.Set(TracestateHeader, t.State)
+	}
+}
+
+// ContextWithTrace returns a copy of ctx carrying the trace context.
+func ContextWithTrace(ctx context.Context, t TraceContext) context.Context {
+	return context.WithValue(ctx, TraceCtxKey, t)
+}
+
+// TraceFromContext returns the trace context in ctx, false is returned when there is none.
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	t, ok := ctx.Value(TraceCtxKey).(TraceContext)
+	return t, ok
+}
+
+// ParseTrace returns the trace context from http.Request context.
+func ParseTrace(r *http.Request) TraceContext {
+	t, _ := TraceFromContext(r.Context())
+	return t
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// randomHex returns n random bytes in hex, never all zeros.
+func randomHex(n int) string {
+	b := make([]byte, n)
+
+	for {
+		_, _ = rand.Read(b)
+
+		for _, c := range b {
+			if c != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package httplog_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tc, ok := httplog.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.Equal(t, httplog.TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		ParentSpanID: "00f067aa0ba902b7", Flags: "01"}, tc)
+
+	for _, h := range []string{
+		"",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, ok := httplog.ParseTraceparent(h)
+		assert.False(t, ok, h)
+	}
+}
+
+func TestTraceContext(t *testing.T) {
+	logs := make(chanStore, 2)
+
+	var propagated http.Header
+
+	m := httplog.NewMux(http.NewServeMux(), logs)
+	m.HandleFunc("/trace", func(w http.ResponseWriter, r *http.Request) {
+		propagated = make(http.Header)
+		httplog.ParseTrace(r).Inject(propagated)
+	}, httplog.Biz("trace"))
+
+	r, _ := http.NewRequest("GET", "/trace", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set("tracestate", "congo=t61rcWkgMzE")
+	m.ServeHTTP(httptest.NewRecorder(), r)
+
+	l := <-logs
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", l.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", l.ParentSpanID)
+	assert.Len(t, l.SpanID, 16)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+l.SpanID+"-01", propagated.Get("traceparent"))
+	assert.Equal(t, "congo=t61rcWkgMzE", propagated.Get("tracestate"))
+
+	r, _ = http.NewRequest("GET", "/trace", nil)
+	m.ServeHTTP(httptest.NewRecorder(), r)
+
+	l = <-logs
+	assert.Len(t, l.TraceID, 32)
+	assert.Len(t, l.SpanID, 16)
+	assert.Equal(t, "", l.ParentSpanID)
+	assert.Equal(t, "00-"+l.TraceID+"-"+l.SpanID+"-01", propagated.Get("traceparent"))
+
+	var body string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+
+	store := httplog.NewOTLPStore(server.URL+"/v1/traces", httplog.OTLPServiceName("demo"),
+		httplog.OTLPBatch(10, time.Hour))
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "1", Biz: "hello", Method: "GET", URL: "/hello/bingoo?x=1",
+		Route: "/hello/:name", RspStatus: 500, TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID: "00f067aa0ba902b7", Start: time.Unix(1, 0), End: time.Unix(2, 0)}))
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "2"}))
+	assert.Nil(t, store.Close(context.Background()))
+
+	assert.JSONEq(t, `{"resourceSpans":[{
+"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"demo"}}]},
+"scopeSpans":[{"scope":{"name":"httplog"},"spans":[{
+  "traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7",
+  "name":"GET /hello/:name","kind":2,
+  "startTimeUnixNano":"1000000000","endTimeUnixNano":"2000000000",
+  "attributes":[
+    {"key":"http.request.method","value":{"stringValue":"GET"}},
+    {"key":"url.path","value":{"stringValue":"/hello/bingoo"}},
+    {"key":"http.response.status_code","value":{"intValue":"500"}},
+    {"key":"http.request.body.size","value":{"intValue":"0"}},
+    {"key":"http.response.body.size","value":{"intValue":"0"}},
+    {"key":"httplog.id","value":{"stringValue":"1"}},
+    {"key":"http.route","value":{"stringValue":"/hello/:name"}},
+    {"key":"httplog.biz","value":{"stringValue":"hello"}}],
+  "status":{"code":2}}]}]}]}`, body)
+}
@@ -2,9 +2,11 @@ package httplog
 
 import (
 	"bufio"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"unicode/utf8"
 )
 
 // At returns the element of index i in the slice s.
@@ -61,17 +63,20 @@ func GetRemoteAddress(r *http.Request) string {
 }
 
 // IsWsRequest return true if this request is a websocket request.
+//
+// Deprecated: WebSocket requests are logged now, use IsWebSocketUpgrade to detect them by the Upgrade header.
 func IsWsRequest(url string) bool {
 	return strings.HasPrefix(url, "/ws/")
 }
 
 // PeekBody peeks the maxSize body from the request limit to maxSize bytes.
 func PeekBody(r *http.Request, maxSize int) []byte {
-	if r.Body == nil {
+	if r.Body == nil || maxSize <= 0 {
 		return nil
 	}
 
-	buf := bufio.NewReader(r.Body)
+	// the default buffer of 4096 bytes limits the bytes to be peeked.
+	buf := bufio.NewReaderSize(r.Body, maxSize)
 	// And now set a new body, which will simulate the same rowsData we read:
 	r.Body = ioutil.NopCloser(buf)
 
@@ -87,3 +92,21 @@ func PeekBody(r *http.Request, maxSize int) []byte {
 
 	return peek
 }
+
+// countingReadCloser counts the bytes read.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// bodyState tells whether the captured body is binary, or truncated from the size.
+func bodyState(body string, size int64) (binary, truncated bool) {
+	return !utf8.ValidString(body) || strings.ContainsRune(body, 0), int64(len(body)) < size
+}
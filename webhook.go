@@ -0,0 +1,294 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WebhookOption defines the option of WebhookStore.
+type WebhookOption struct {
+	// Method is the method of the requests, default POST.
+	Method string
+	// Template is the Go template to render the body, executed with []WebhookEntry,
+	// the function json marshals its argument, like {{range .}}{{json .Record}}{{end}}.
+	// When it is empty, the body is the JSON of the fields, an object for one log, or an array for a batch.
+	Template string
+	// Fields maps the JSON fields to the log values, default DefaultFieldMapping().
+	Fields FieldMapping
+	// ContentType is the Content-Type of the requests, default application/json.
+	ContentType string
+	// BatchSize is the max number of logs in one request, default 1 to send each log synchronously.
+	BatchSize int
+	// FlushInterval is the max delay of a log waiting in the batch, default 1s.
+	FlushInterval time.Duration
+	// MaxBuffered is the max number of logs waiting in the batch, the newer logs are dropped when full, default 10000.
+	MaxBuffered int
+	// Timeout is the timeout of a request, default 5s.
+	Timeout time.Duration
+	// Backoff retries the requests failed by network errors, 429 or 5xx, default DefaultBackoff().
+	Backoff Backoff
+	// DeadLetter, if not nil, receives the logs still failing after the retries.
+	DeadLetter Store
+	// Header is the additional header of the requests.
+	Header http.Header
+}
+
+// WebhookOptionFn defines the function prototype to setting WebhookOption.
+type WebhookOptionFn func(o *WebhookOption)
+
+// WebhookMethod set the method of the requests.
+func WebhookMethod(method string) WebhookOptionFn {
+	return func(o *WebhookOption) { o.Method = method }
+}
+
+// WebhookTemplate set the Go template to render the body.
+func WebhookTemplate(text string) WebhookOptionFn {
+	return func(o *WebhookOption) { o.Template = text }
+}
+
+// WebhookFields set the mapping of the JSON fields.
+func WebhookFields(fields FieldMapping) WebhookOptionFn {
+	return func(o *WebhookOption) { o.Fields = fields }
+}
+
+// WebhookContentType set the Content-Type of the requests.
+func WebhookContentType(contentType string) WebhookOptionFn {
+	return func(o *WebhookOption) { o.ContentType = contentType }
+}
+
+// WebhookBatch set the max number of logs in one request, and the max delay of a log.
+func WebhookBatch(size int, interval time.Duration) WebhookOptionFn {
+	return func(o *WebhookOption) {
+		o.BatchSize = size
+		o.FlushInterval = interval
+	}
+}
+
+// WebhookTimeout set the timeout of a request.
+func WebhookTimeout(timeout time.Duration) WebhookOptionFn {
+	return func(o *WebhookOption) { o.Timeout = timeout }
+}
+
+// WebhookRetry set the backoff to retry the failures, and the dead letter store for the logs still failing.
+func WebhookRetry(backoff Backoff, deadLetter Store) WebhookOptionFn {
+	return func(o *WebhookOption) {
+		o.Backoff = backoff
+		o.DeadLetter = deadLetter
+	}
+}
+
+// WebhookHeader set an additional header of the requests.
+func WebhookHeader(key, value string) WebhookOptionFn {
+	return func(o *WebhookOption) { o.Header.Set(key, value) }
+}
+
+// WebhookBasicAuth set the basic authentication of the requests.
+func WebhookBasicAuth(username, password string) WebhookOptionFn {
+	return func(o *WebhookOption) {
+		r, _ := http.NewRequest(http.MethodPost, "/", nil)
+		r.SetBasicAuth(username, password)
+		o.Header.Set("Authorization", r.Header.Get("Authorization"))
+	}
+}
+
+// WebhookBearer set the bearer token of the requests.
+func WebhookBearer(token string) WebhookOptionFn {
+	return func(o *WebhookOption) { o.Header.Set("Authorization", "Bearer "+token) }
+}
+
+// WebhookEntry is the data of a log to render the body template.
+type WebhookEntry struct {
+	Log    *Log
+	Record *LogRecord
+	// Fields are the values by the field mapping.
+	Fields map[string]interface{}
+}
+
+// WebhookStore sends the logs to a URL by HTTP requests, like to log collectors and audit services.
+type WebhookStore struct {
+	url      string
+	option   *WebhookOption
+	template *template.Template
+	getters  fieldGetters
+	client   *http.Client
+	batcher  *batcher
+}
+
+// NewWebhookStore creates a new WebhookStore sending to the url, the error is returned when the template is invalid.
+func NewWebhookStore(url string, fns ...WebhookOptionFn) (*WebhookStore, error) {
+	option := &WebhookOption{
+		Method:        http.MethodPost,
+		Fields:        DefaultFieldMapping(),
+		ContentType:   "application/json",
+		BatchSize:     1,
+		FlushInterval: time.Second,
+		MaxBuffered:   10000,
+		Timeout:       5 * time.Second,
+		Backoff:       DefaultBackoff(),
+		Header:        make(http.Header),
+	}
+
+	for _, fn := range fns {
+		fn(option)
+	}
+
+	s := &WebhookStore{
+		url:     url,
+		option:  option,
+		getters: option.Fields.compile(),
+		client:  &http.Client{Timeout: option.Timeout},
+	}
+
+	if option.Template != "" {
+		t, err := template.New("webhook").Funcs(template.FuncMap{"json": webhookJSON}).Parse(option.Template)
+		if err != nil {
+			return nil, err
+		}
+
+		s.template = t
+	}
+
+	if option.BatchSize > 1 {
+		s.batcher = newBatcher(option.BatchSize, option.MaxBuffered, option.FlushInterval, func(items []interface{}) {
+			logs := make([]*Log, len(items))
+			for i, item := range items {
+				logs[i] = item.(*Log)
+			}
+
+			if err := s.send(logs); err != nil {
+				logrus.Warnf("failed to send %d logs to %s, error: %v", len(logs), s.url, err)
+			}
+		})
+	}
+
+	return s, nil
+}
+
+func webhookJSON(v interface{}) (string, error) {
+	b, err := JSONMarshal(v)
+	return string(b), err
+}
+
+// Store stores the log in database like MySQL, InfluxDB, and etc.
+func (s *WebhookStore) Store(log *Log) {
+	if err := s.StoreE(log); err != nil {
+		logrus.Warnf("failed to send log %s to %s, error: %v", log.ID, s.url, err)
+	}
+}
+
+// StoreE sends the log, or adds it to the batch in batch mode,
+// ErrDropped is returned when the batch is full or the store is closed.
+func (s *WebhookStore) StoreE(log *Log) error {
+	if s.batcher == nil {
+		return s.send([]*Log{log})
+	}
+
+	return s.batcher.add(log)
+}
+
+// send sends the logs by one request with retries, and sends them to the dead letter store when failed.
+func (s *WebhookStore) send(logs []*Log) error {
+	body, err := s.render(logs)
+	if err != nil {
+		return err
+	}
+
+	delay := s.option.Backoff.Initial
+
+	for i := 0; ; i++ {
+		retry, err := s.post(body)
+		if err == nil {
+			return nil
+		}
+
+		if !retry || i >= s.option.Backoff.Retries {
+			if s.option.DeadLetter == nil {
+				return err
+			}
+
+			for _, l := range logs {
+				s.option.DeadLetter.Store(l)
+			}
+
+			return err
+		}
+
+		time.Sleep(delay)
+		delay = s.option.Backoff.next(delay)
+	}
+}
+
+// render renders the body of the logs by the template or by the field mapping.
+func (s *WebhookStore) render(logs []*Log) ([]byte, error) {
+	if s.template == nil {
+		if s.batcher == nil {
+			return JSONMarshal(s.getters.document(logs[0]))
+		}
+
+		docs := make([]map[string]interface{}, len(logs))
+		for i, l := range logs {
+			docs[i] = s.getters.document(l)
+		}
+
+		return JSONMarshal(docs)
+	}
+
+	entries := make([]WebhookEntry, len(logs))
+	for i, l := range logs {
+		entries[i] = WebhookEntry{Log: l, Record: l.Record(), Fields: s.getters.document(l)}
+	}
+
+	var b bytes.Buffer
+	if err := s.template.Execute(&b, entries); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// post sends the body, and tells whether to retry when failed.
+func (s *WebhookStore) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(s.option.Method, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	for k, v := range s.option.Header {
+		req.Header[k] = v
+	}
+
+	req.Header.Set("Content-Type", s.option.ContentType)
+
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+
+	defer rsp.Body.Close()
+
+	content, _ := ioutil.ReadAll(rsp.Body)
+
+	if rsp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("webhook status %d: %s", rsp.StatusCode, Abbreviate(string(content), 200))
+
+	return rsp.StatusCode == http.StatusTooManyRequests || rsp.StatusCode >= 500, err
+}
+
+// Close stops accepting logs, and sends the logs in the batch until ctx is done.
+func (s *WebhookStore) Close(ctx context.Context) error {
+	if s.batcher == nil {
+		return nil
+	}
+
+	return s.batcher.close(ctx)
+}
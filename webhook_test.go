@@ -0,0 +1,68 @@
+package httplog_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookStore(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+		calls  int
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if calls++; calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	store, err := httplog.NewWebhookStore(server.URL, httplog.WebhookBearer("token"),
+		httplog.WebhookTemplate(`{{range .}}{{.Record.ID}} {{.Fields.biz}} {{json .Record.RspStatus}};{{end}}`),
+		httplog.WebhookFields(httplog.FieldMapping{"biz": "biz"}),
+		httplog.WebhookBatch(2, time.Hour), httplog.WebhookRetry(httplog.Backoff{Retries: 1}, nil))
+	assert.Nil(t, err)
+
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "1", Biz: "a", RspStatus: 200}))
+	assert.Nil(t, store.StoreE(&httplog.Log{ID: "2", Biz: "b", RspStatus: 500}))
+	assert.Nil(t, store.Close(context.Background()))
+	assert.Equal(t, []string{"1 a 200;2 b 500;"}, bodies)
+
+	// the field mapping body, failing without retry on 4xx.
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.JSONEq(t, `{"biz":"a","status":200}`, string(body))
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer bad.Close()
+
+	dead := &switchStore{}
+	store, err = httplog.NewWebhookStore(bad.URL, httplog.WebhookRetry(httplog.DefaultBackoff(), dead),
+		httplog.WebhookFields(httplog.FieldMapping{"biz": "biz", "status": "rsp_status"}))
+	assert.Nil(t, err)
+	assert.NotNil(t, store.StoreE(&httplog.Log{ID: "3", Biz: "a", RspStatus: 200}))
+	assert.Equal(t, []string{"3"}, dead.IDs())
+
+	_, err = httplog.NewWebhookStore(bad.URL, httplog.WebhookTemplate(`{{.Bad`))
+	assert.NotNil(t, err)
+}
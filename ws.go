@@ -0,0 +1,423 @@
+package httplog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes, see https://tools.ietf.org/html/rfc6455#section-5.2.
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+
+	// wsCloseAbnormal is the close code when the connection closed without a close frame.
+	wsCloseAbnormal = 1006
+	// maxHandshakeSize limits the bytes to buffer for the raw handshake response.
+	maxHandshakeSize = 8192
+)
+
+// WsSession records the statistics of a WebSocket session.
+type WsSession struct {
+	// CloseCode is the status code of the first close frame, or 1006 if no close frame was seen.
+	CloseCode int
+	// InFrames and InBytes count the frames and bytes received from the client.
+	InFrames int64
+	InBytes  int64
+	// OutFrames and OutBytes count the frames and bytes sent to the client.
+	OutFrames int64
+	OutBytes  int64
+	// Messages samples the first data frames of the session.
+	Messages []WsMessage
+}
+
+// WsMessage is a sampled WebSocket data frame.
+type WsMessage struct {
+	// Dir is "in" for client to server, "out" for server to client.
+	Dir  string
+	Time time.Time
+	// Type is text, binary or compressed (when permessage-deflate is used).
+	Type string
+	// Data is the payload, base64 encoded for binary types, limited to the max body size.
+	Data string
+}
+
+// IsWebSocketUpgrade tells whether the request asks for upgrading to WebSocket by the Upgrade header.
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h[name] {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// wsConn wraps the hijacked connection to count and sample the WebSocket frames in each direction.
+type wsConn struct {
+	net.Conn
+
+	mu       sync.Mutex
+	session  WsSession
+	in, out  *wsFrameParser
+	closed   bool
+	closedAt time.Time
+	onClose  func()
+
+	// handshake buffers the raw HTTP response written on the hijacked connection.
+	handshake     []byte
+	handshakeDone bool
+	rspStatus     int
+	rspHeader     http.Header
+
+	closeOnce sync.Once
+}
+
+func newWsConn(conn net.Conn, sampleMessages, maxMessageSize int, handshakeDone bool) *wsConn {
+	c := &wsConn{Conn: conn, handshakeDone: handshakeDone}
+	c.session.CloseCode = wsCloseAbnormal
+	samples := &wsSampler{conn: c, remain: sampleMessages, maxSize: maxMessageSize}
+	c.in = &wsFrameParser{dir: "in", sampler: samples, frames: &c.session.InFrames, bytes: &c.session.InBytes}
+	c.out = &wsFrameParser{dir: "out", sampler: samples, frames: &c.session.OutFrames, bytes: &c.session.OutBytes}
+
+	return c
+}
+
+// wrapBufio creates a new bufio.ReadWriter on the wrapped connection,
+// so that the frames read or written through the hijacked bufio.ReadWriter are also counted.
+func (c *wsConn) wrapBufio(brw *bufio.ReadWriter) *bufio.ReadWriter {
+	r := bufio.NewReader(c)
+
+	if n := brw.Reader.Buffered(); n > 0 {
+		buffered, _ := brw.Reader.Peek(n)
+		buffered = append([]byte(nil), buffered...)
+		c.feedIn(buffered)
+		r = bufio.NewReader(&prefixReader{prefix: buffered, conn: c})
+	}
+
+	return bufio.NewReadWriter(r, bufio.NewWriter(c))
+}
+
+// Read reads data from the connection.
+func (c *wsConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.feedIn(b[:n])
+
+	return n, err
+}
+
+// Write writes data to the connection.
+func (c *wsConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.feedOut(b[:n])
+
+	return n, err
+}
+
+// Close closes the connection.
+func (c *wsConn) Close() error {
+	err := c.Conn.Close()
+
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		c.closedAt = time.Now()
+		onClose := c.onClose
+		c.mu.Unlock()
+
+		if onClose != nil {
+			onClose()
+		}
+	})
+
+	return err
+}
+
+// finish calls fn when the connection is closed, or immediately if it has been closed already.
+func (c *wsConn) finish(fn func()) {
+	c.mu.Lock()
+
+	if !c.closed {
+		c.onClose = fn
+		c.mu.Unlock()
+
+		return
+	}
+
+	c.mu.Unlock()
+	fn()
+}
+
+// fill fills the log with the session statistics, the handshake response and the close time.
+func (c *wsConn) fill(l *Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.session
+	s.Messages = append([]WsMessage(nil), c.session.Messages...)
+	l.Ws = &s
+
+	if c.rspStatus != 0 {
+		l.RspStatus = c.rspStatus
+		l.RspHeader = c.rspHeader
+	}
+
+	l.End = c.closedAt
+	l.Duration = l.End.Sub(l.Start)
+}
+
+func (c *wsConn) feedIn(b []byte) {
+	c.mu.Lock()
+	c.in.feed(b)
+	c.mu.Unlock()
+}
+
+func (c *wsConn) feedOut(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.handshakeDone {
+		b = c.parseHandshake(b)
+	}
+
+	c.out.feed(b)
+}
+
+// parseHandshake buffers the raw handshake response until its end,
+// and returns the remaining bytes which belong to the frames.
+func (c *wsConn) parseHandshake(b []byte) []byte {
+	c.handshake = append(c.handshake, b...)
+
+	idx := bytes.Index(c.handshake, []byte("\r\n\r\n"))
+	if idx < 0 {
+		if len(c.handshake) > maxHandshakeSize {
+			c.handshake, c.handshakeDone = nil, true
+		}
+
+		return nil
+	}
+
+	rest := c.handshake[idx+4:]
+	rsp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(c.handshake[:idx+4])), nil)
+
+	if err == nil {
+		c.rspStatus = rsp.StatusCode
+		c.rspHeader = rsp.Header
+	}
+
+	c.handshake, c.handshakeDone = nil, true
+
+	return rest
+}
+
+type prefixReader struct {
+	prefix []byte
+	conn   *wsConn
+}
+
+// Read reads the buffered prefix first, and then the connection.
+func (p *prefixReader) Read(b []byte) (int, error) {
+	if len(p.prefix) > 0 {
+		n := copy(b, p.prefix)
+		p.prefix = p.prefix[n:]
+
+		return n, nil
+	}
+
+	return p.conn.Read(b)
+}
+
+// wsSampler samples the first data frames in both directions.
+type wsSampler struct {
+	conn    *wsConn
+	remain  int
+	maxSize int
+}
+
+func (s *wsSampler) want() bool { return s.remain > 0 }
+
+func (s *wsSampler) add(dir string, opcode byte, compressed bool, payload []byte) {
+	if s.remain <= 0 {
+		return
+	}
+
+	s.remain--
+
+	m := WsMessage{Dir: dir, Time: time.Now()}
+
+	switch {
+	case compressed:
+		m.Type = "compressed"
+		m.Data = base64.StdEncoding.EncodeToString(payload)
+	case opcode == wsOpText:
+		m.Type = "text"
+		m.Data = string(payload)
+	default:
+		m.Type = "binary"
+		m.Data = base64.StdEncoding.EncodeToString(payload)
+	}
+
+	s.conn.session.Messages = append(s.conn.session.Messages, m)
+}
+
+// wsFrameParser parses the WebSocket frames from the byte stream of one direction incrementally.
+type wsFrameParser struct {
+	dir     string
+	sampler *wsSampler
+	frames  *int64
+	bytes   *int64
+
+	head      []byte
+	inPayload bool
+	remain    uint64
+	opcode    byte
+	msgOpcode byte
+	rsv1      bool
+	masked    bool
+	mask      [4]byte
+	pos       uint64
+	collect   int
+	payload   []byte
+}
+
+func (p *wsFrameParser) feed(b []byte) {
+	*p.bytes += int64(len(b))
+
+	for len(b) > 0 {
+		if !p.inPayload {
+			p.head = append(p.head, b[0])
+			b = b[1:]
+
+			if len(p.head) >= wsHeaderLen(p.head) {
+				p.startFrame()
+			}
+
+			continue
+		}
+
+		n := uint64(len(b))
+		if n > p.remain {
+			n = p.remain
+		}
+
+		p.collectPayload(b[:n])
+		b = b[n:]
+		p.remain -= n
+
+		if p.remain == 0 {
+			p.finishFrame()
+		}
+	}
+}
+
+// wsHeaderLen returns the length of the frame header h, or more than len(h) when h is incomplete.
+func wsHeaderLen(h []byte) int {
+	if len(h) < 2 {
+		return 2
+	}
+
+	n := 2
+
+	switch h[1] & 0x7f {
+	case 126:
+		n += 2
+	case 127:
+		n += 8
+	}
+
+	if h[1]&0x80 != 0 {
+		n += 4
+	}
+
+	return n
+}
+
+func (p *wsFrameParser) startFrame() {
+	h := p.head
+	p.opcode = h[0] & 0x0f
+	p.masked = h[1]&0x80 != 0
+	p.remain = uint64(h[1] & 0x7f)
+	off := 2
+
+	switch p.remain {
+	case 126:
+		p.remain = uint64(binary.BigEndian.Uint16(h[2:4]))
+		off = 4
+	case 127:
+		p.remain = binary.BigEndian.Uint64(h[2:10])
+		off = 10
+	}
+
+	if p.masked {
+		copy(p.mask[:], h[off:off+4])
+	}
+
+	if p.opcode != wsOpContinuation {
+		p.msgOpcode = p.opcode
+		p.rsv1 = h[0]&0x40 != 0
+	}
+
+	*p.frames++
+	p.inPayload = true
+	p.pos = 0
+	p.payload = nil
+
+	switch {
+	case p.opcode == wsOpClose:
+		p.collect = 2
+	case p.opcode <= wsOpBinary && p.sampler.want():
+		p.collect = p.sampler.maxSize
+	default:
+		p.collect = 0
+	}
+
+	if p.remain == 0 {
+		p.finishFrame()
+	}
+}
+
+func (p *wsFrameParser) collectPayload(b []byte) {
+	for i := 0; i < len(b) && len(p.payload) < p.collect; i++ {
+		c := b[i]
+		if p.masked {
+			c ^= p.mask[(p.pos+uint64(i))%4]
+		}
+
+		p.payload = append(p.payload, c)
+	}
+
+	p.pos += uint64(len(b))
+}
+
+func (p *wsFrameParser) finishFrame() {
+	switch {
+	case p.opcode == wsOpClose:
+		if c := p.sampler.conn; c.session.CloseCode == wsCloseAbnormal {
+			c.session.CloseCode = 1005 // No Status Received
+			if len(p.payload) >= 2 {
+				c.session.CloseCode = int(binary.BigEndian.Uint16(p.payload))
+			}
+		}
+	case p.opcode <= wsOpBinary && p.collect > 0:
+		p.sampler.add(p.dir, p.msgOpcode, p.rsv1, p.payload)
+	}
+
+	p.head = p.head[:0]
+	p.inPayload = false
+	p.payload = nil
+}
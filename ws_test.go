@@ -0,0 +1,111 @@
+package httplog_test
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bingoohuang/httplog"
+	"github.com/stretchr/testify/assert"
+)
+
+type chanStore chan *httplog.Log
+
+func (s chanStore) Store(l *httplog.Log) { s <- l }
+
+// handleWsEcho is a minimal WebSocket echo handler which echoes one frame and then closes.
+func handleWsEcho(w http.ResponseWriter, r *http.Request) {
+	conn, brw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+
+	defer conn.Close()
+
+	_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: fake\r\n\r\n"))
+
+	for {
+		opcode, payload := readWsFrame(brw.Reader)
+		_, _ = conn.Write(append([]byte{0x80 | opcode, byte(len(payload))}, payload...))
+
+		if opcode == 0x8 {
+			return
+		}
+	}
+}
+
+func readWsFrame(r *bufio.Reader) (byte, []byte) {
+	h0, _ := r.ReadByte()
+	h1, _ := r.ReadByte()
+	mask := make([]byte, 4)
+
+	for i := range mask {
+		mask[i], _ = r.ReadByte()
+	}
+
+	payload := make([]byte, h1&0x7f)
+	for i := range payload {
+		b, _ := r.ReadByte()
+		payload[i] = b ^ mask[i%4]
+	}
+
+	return h0 & 0x0f, payload
+}
+
+func writeMaskedFrame(conn net.Conn, opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask...)
+
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, _ = conn.Write(frame)
+}
+
+func TestWebSocketSession(t *testing.T) {
+	store := make(chanStore, 1)
+	mux := httplog.NewMux(http.NewServeMux(), store, httplog.WsSampleMessages(2))
+	mux.HandleFunc("/echo", handleWsEcho, httplog.Biz("ws-echo"))
+
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	assert.Nil(t, err)
+
+	defer conn.Close()
+
+	_, _ = conn.Write([]byte("GET /echo HTTP/1.1\r\nHost: localhost\r\n" +
+		"Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+
+	br := bufio.NewReader(conn)
+	rsp, err := http.ReadResponse(br, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, rsp.StatusCode)
+
+	writeMaskedFrame(conn, 0x1, []byte("hello"))
+	writeMaskedFrame(conn, 0x8, []byte{0x03, 0xe8}) // 1000 Normal Closure
+
+	select {
+	case l := <-store:
+		assert.Equal(t, "ws-echo", l.Biz)
+		assert.Equal(t, http.StatusSwitchingProtocols, l.RspStatus)
+		assert.Equal(t, "fake", l.RspHeader.Get("Sec-WebSocket-Accept"))
+		assert.NotNil(t, l.Ws)
+		assert.Equal(t, 1000, l.Ws.CloseCode)
+		assert.Equal(t, int64(2), l.Ws.InFrames)
+		assert.Equal(t, int64(2), l.Ws.OutFrames)
+		assert.Equal(t, int64(6+5+6+2), l.Ws.InBytes)
+		assert.Equal(t, int64(2+5+2+2), l.Ws.OutBytes)
+		assert.Equal(t, []string{"in", "out"}, []string{l.Ws.Messages[0].Dir, l.Ws.Messages[1].Dir})
+		assert.Equal(t, "hello", l.Ws.Messages[0].Data)
+		assert.Equal(t, "hello", l.Ws.Messages[1].Data)
+	case <-time.After(3 * time.Second):
+		t.Fatal("WebSocket session is not logged")
+	}
+}